@@ -0,0 +1,75 @@
+// Package analysis computes pacing reports from recorded splits.
+package analysis
+
+import (
+	"math"
+
+	"laplogger/models"
+)
+
+// AnalyzeSplits builds a pacing report for a swim over eventDistance from its
+// splits, which must be ordered and finish at the event distance. pbSplits
+// are the splits of the swimmer's best other swim in the event and may be
+// nil; they are compared against at every distance both swims have a split.
+//
+// The front half is the elapsed time at half the event distance, linearly
+// interpolated when there is no split exactly there, and the back half is
+// the rest of the swim. Fade is how much slower the back half is than the
+// front half as a percentage, so a negative split has a negative fade.
+func AnalyzeSplits(splits, pbSplits []models.Split, eventDistance int) models.SplitAnalysis {
+	report := models.SplitAnalysis{
+		Laps: make([]models.LapAnalysis, 0, len(splits)),
+	}
+	if len(splits) == 0 {
+		return report
+	}
+
+	pbAt := make(map[int]int, len(pbSplits))
+	for _, split := range pbSplits {
+		pbAt[split.Distance] = split.CumulativeMs
+	}
+
+	for i, split := range splits {
+		lap := models.LapAnalysis{
+			SplitNum:     split.SplitNum,
+			Distance:     split.Distance,
+			LapMs:        split.LapMs,
+			CumulativeMs: split.CumulativeMs,
+		}
+		if i > 0 {
+			delta := split.LapMs - splits[i-1].LapMs
+			lap.DeltaMs = &delta
+		}
+		if pb, ok := pbAt[split.Distance]; ok {
+			diff := split.CumulativeMs - pb
+			lap.PBCumulativeMs = &pb
+			lap.VsPBMs = &diff
+		}
+		report.Laps = append(report.Laps, lap)
+	}
+
+	total := splits[len(splits)-1].CumulativeMs
+	report.FrontHalfMs = elapsedAt(splits, float64(eventDistance)/2)
+	report.BackHalfMs = total - report.FrontHalfMs
+	report.DifferentialMs = report.BackHalfMs - report.FrontHalfMs
+	report.NegativeSplit = report.DifferentialMs < 0
+	if report.FrontHalfMs > 0 {
+		report.FadePct = math.Round(float64(report.DifferentialMs)/float64(report.FrontHalfMs)*10000) / 100
+	}
+
+	return report
+}
+
+// elapsedAt estimates the elapsed time at a distance, interpolating linearly
+// between the surrounding splits
+func elapsedAt(splits []models.Split, distance float64) int {
+	previousDistance, previousMs := 0.0, 0.0
+	for _, split := range splits {
+		d, ms := float64(split.Distance), float64(split.CumulativeMs)
+		if d >= distance {
+			return int(math.Round(previousMs + (ms-previousMs)*(distance-previousDistance)/(d-previousDistance)))
+		}
+		previousDistance, previousMs = d, ms
+	}
+	return int(previousMs)
+}
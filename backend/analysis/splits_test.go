@@ -0,0 +1,102 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"laplogger/models"
+)
+
+// cumulative builds evenly spaced splits from their elapsed times
+func cumulative(splitDistance int, elapsed ...int) []models.Split {
+	splits := make([]models.Split, len(elapsed))
+	for i, ms := range elapsed {
+		splits[i] = models.Split{SplitNum: i + 1, Distance: splitDistance * (i + 1), CumulativeMs: ms, LapMs: ms}
+		if i > 0 {
+			splits[i].LapMs -= elapsed[i-1]
+		}
+	}
+	return splits
+}
+
+func ms(value int) *int { return &value }
+
+func TestAnalyzeSplits(t *testing.T) {
+	tests := []struct {
+		name     string
+		splits   []models.Split
+		pbSplits []models.Split
+		distance int
+		want     models.SplitAnalysis
+	}{
+		{
+			name:     "even split count with a PB",
+			splits:   cumulative(25, 14000, 29500, 45500, 62000),
+			pbSplits: cumulative(25, 13800, 29000, 45000, 61500),
+			distance: 100,
+			want: models.SplitAnalysis{
+				Laps: []models.LapAnalysis{
+					{SplitNum: 1, Distance: 25, LapMs: 14000, CumulativeMs: 14000, PBCumulativeMs: ms(13800), VsPBMs: ms(200)},
+					{SplitNum: 2, Distance: 50, LapMs: 15500, CumulativeMs: 29500, DeltaMs: ms(1500), PBCumulativeMs: ms(29000), VsPBMs: ms(500)},
+					{SplitNum: 3, Distance: 75, LapMs: 16000, CumulativeMs: 45500, DeltaMs: ms(500), PBCumulativeMs: ms(45000), VsPBMs: ms(500)},
+					{SplitNum: 4, Distance: 100, LapMs: 16500, CumulativeMs: 62000, DeltaMs: ms(500), PBCumulativeMs: ms(61500), VsPBMs: ms(500)},
+				},
+				FrontHalfMs:    29500,
+				BackHalfMs:     32500,
+				DifferentialMs: 3000,
+				FadePct:        10.17,
+			},
+		},
+		{
+			// Halfway is 75, between the first and second splits
+			name:     "odd split count without a PB",
+			splits:   cumulative(50, 30000, 62000, 95000),
+			distance: 150,
+			want: models.SplitAnalysis{
+				Laps: []models.LapAnalysis{
+					{SplitNum: 1, Distance: 50, LapMs: 30000, CumulativeMs: 30000},
+					{SplitNum: 2, Distance: 100, LapMs: 32000, CumulativeMs: 62000, DeltaMs: ms(2000)},
+					{SplitNum: 3, Distance: 150, LapMs: 33000, CumulativeMs: 95000, DeltaMs: ms(1000)},
+				},
+				FrontHalfMs:    46000,
+				BackHalfMs:     49000,
+				DifferentialMs: 3000,
+				FadePct:        6.52,
+			},
+		},
+		{
+			// The PB is compared only where both swims have a split
+			name:     "negative split",
+			splits:   cumulative(50, 30000, 61000, 91500, 121500),
+			pbSplits: cumulative(100, 60000, 120000),
+			distance: 200,
+			want: models.SplitAnalysis{
+				Laps: []models.LapAnalysis{
+					{SplitNum: 1, Distance: 50, LapMs: 30000, CumulativeMs: 30000},
+					{SplitNum: 2, Distance: 100, LapMs: 31000, CumulativeMs: 61000, DeltaMs: ms(1000), PBCumulativeMs: ms(60000), VsPBMs: ms(1000)},
+					{SplitNum: 3, Distance: 150, LapMs: 30500, CumulativeMs: 91500, DeltaMs: ms(-500)},
+					{SplitNum: 4, Distance: 200, LapMs: 30000, CumulativeMs: 121500, DeltaMs: ms(-500), PBCumulativeMs: ms(120000), VsPBMs: ms(1500)},
+				},
+				FrontHalfMs:    61000,
+				BackHalfMs:     60500,
+				DifferentialMs: -500,
+				NegativeSplit:  true,
+				FadePct:        -0.82,
+			},
+		},
+		{
+			name:     "no splits",
+			distance: 100,
+			want:     models.SplitAnalysis{Laps: []models.LapAnalysis{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeSplits(tt.splits, tt.pbSplits, tt.distance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeSplits =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package conversion converts swim times between pool courses (SCY, SCM and
+// LCM) using the factor and turn-increment method popularised by Hy-Tek and
+// used for USA Swimming and NCAA style comparisons.
+//
+// Yards and short course meters times have the same number of turns, so they
+// convert with a single pace factor. Short course and long course meters
+// times differ by the turns saved in a 50 meter pool, so they convert by
+// adding or removing a per-stroke increment for every turn. The yards
+// distance freestyles convert to long course with a single factor.
+package conversion
+
+import (
+	"errors"
+	"math"
+
+	"laplogger/models"
+)
+
+// ErrUnsupported is returned when an event has no equivalent in the target course
+var ErrUnsupported = errors.New("conversion: event has no equivalent in the target course")
+
+// yardsToMetersFactor converts an SCY time to an SCM time over the same
+// nominal distance
+const yardsToMetersFactor = 1.11
+
+// turnIncrementMs is the time in milliseconds a swimmer gains from each
+// extra turn in a short course pool, by stroke name
+var turnIncrementMs = map[string]float64{
+	"Freestyle":         800,
+	"Backstroke":        600,
+	"Breaststroke":      1000,
+	"Butterfly":         700,
+	"Individual Medley": 800,
+}
+
+// yardsToMeters maps yards distances onto their meters equivalents where the
+// nominal distance differs (the distance freestyle events)
+var yardsToMeters = map[int]int{
+	500:  400,
+	1000: 800,
+	1650: 1500,
+}
+
+// yardsToLongCourseFactors convert SCY distance freestyle times straight to
+// the LCM event, by yards distance. The turn increments overstate what a
+// swimmer gains from the many turns of these events, so Hy-Tek's tables use
+// a single factor instead.
+var yardsToLongCourseFactors = map[int]float64{
+	500:  0.8925,
+	1000: 0.8925,
+	1650: 1.02,
+}
+
+// Convert converts a time in milliseconds swum over distance in fromCourse to
+// the equivalent event in toCourse. It returns the distance of the equivalent
+// event and the converted time, rounded to hundredths of a second.
+func Convert(stroke string, distance int, fromCourse, toCourse string, timeMs int) (int, int, error) {
+	increment, ok := turnIncrementMs[stroke]
+	if !ok {
+		return 0, 0, ErrUnsupported
+	}
+
+	targetDistance, err := EquivalentDistance(stroke, distance, fromCourse, toCourse)
+	if err != nil {
+		return 0, 0, err
+	}
+	if fromCourse == toCourse {
+		return distance, timeMs, nil
+	}
+
+	if stroke == "Freestyle" {
+		if factor, ok := yardsToLongCourseFactors[distance]; ok && fromCourse == models.CourseSCY && toCourse == models.CourseLCM {
+			return targetDistance, roundToHundredths(float64(timeMs) * factor), nil
+		}
+		if factor, ok := yardsToLongCourseFactors[targetDistance]; ok && fromCourse == models.CourseLCM && toCourse == models.CourseSCY {
+			return targetDistance, roundToHundredths(float64(timeMs) / factor), nil
+		}
+	}
+
+	// Convert through SCM, which shares turns with SCY and distances with LCM
+	scmDistance, err := EquivalentDistance(stroke, distance, fromCourse, models.CourseSCM)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	scm := float64(timeMs)
+	switch fromCourse {
+	case models.CourseSCY:
+		scm = scm * yardsToMetersFactor * float64(scmDistance) / float64(distance)
+	case models.CourseLCM:
+		scm -= increment * turnsSaved(distance)
+	}
+
+	converted := scm
+	switch toCourse {
+	case models.CourseSCY:
+		converted = scm / yardsToMetersFactor * float64(targetDistance) / float64(scmDistance)
+	case models.CourseLCM:
+		converted = scm + increment*turnsSaved(scmDistance)
+	}
+
+	return targetDistance, roundToHundredths(converted), nil
+}
+
+// EquivalentDistance returns the distance of the event in toCourse that
+// corresponds to distance in fromCourse, e.g. 500 SCY freestyle is 400 in
+// meters while 400 IM is 400 in every course
+func EquivalentDistance(stroke string, distance int, fromCourse, toCourse string) (int, error) {
+	if fromCourse == toCourse {
+		return distance, nil
+	}
+
+	// Only the distance freestyle events change distance between yards and
+	// meters; other events keep their nominal distance
+	freestyle := stroke == "Freestyle"
+
+	meters := distance
+	if fromCourse == models.CourseSCY && freestyle {
+		if m, ok := yardsToMeters[distance]; ok {
+			meters = m
+		}
+	}
+
+	// There is no 100 IM in a 50 meter pool
+	if toCourse == models.CourseLCM && stroke == "Individual Medley" && meters < 200 {
+		return 0, ErrUnsupported
+	}
+
+	if toCourse != models.CourseSCY || fromCourse == models.CourseSCY || !freestyle {
+		return meters, nil
+	}
+
+	for yards, m := range yardsToMeters {
+		if m == meters {
+			return yards, nil
+		}
+	}
+	return meters, nil
+}
+
+// turnsSaved is the number of fewer turns a long course swim has than a
+// short course swim over the same distance
+func turnsSaved(distance int) float64 {
+	return float64(distance) / 50
+}
+
+func roundToHundredths(ms float64) int {
+	return int(math.Round(ms/10) * 10)
+}
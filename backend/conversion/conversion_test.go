@@ -0,0 +1,125 @@
+package conversion
+
+import (
+	"errors"
+	"testing"
+
+	"laplogger/models"
+)
+
+var courses = []string{models.CourseSCY, models.CourseSCM, models.CourseLCM}
+
+func TestConvertRoundTrip(t *testing.T) {
+	tests := []struct {
+		stroke   string
+		distance int
+		course   string
+		timeMs   int
+	}{
+		{"Freestyle", 50, models.CourseSCY, 22450},
+		{"Freestyle", 100, models.CourseLCM, 55120},
+		{"Freestyle", 500, models.CourseSCY, 281340},
+		{"Freestyle", 400, models.CourseLCM, 258900},
+		{"Freestyle", 1650, models.CourseSCY, 998760},
+		{"Freestyle", 1500, models.CourseSCM, 1012340},
+		{"Backstroke", 200, models.CourseSCM, 131560},
+		{"Breaststroke", 100, models.CourseLCM, 72880},
+		{"Butterfly", 200, models.CourseSCY, 118040},
+		{"Individual Medley", 200, models.CourseLCM, 138210},
+		{"Individual Medley", 400, models.CourseLCM, 298450},
+		{"Individual Medley", 400, models.CourseSCY, 262330},
+	}
+
+	for _, tt := range tests {
+		for _, to := range courses {
+			distance, converted, err := Convert(tt.stroke, tt.distance, tt.course, to, tt.timeMs)
+			if err != nil {
+				t.Errorf("Convert(%s %d %s -> %s): %v", tt.stroke, tt.distance, tt.course, to, err)
+				continue
+			}
+			backDistance, back, err := Convert(tt.stroke, distance, to, tt.course, converted)
+			if err != nil {
+				t.Errorf("Convert(%s %d %s -> %s): %v", tt.stroke, distance, to, tt.course, err)
+				continue
+			}
+			if backDistance != tt.distance {
+				t.Errorf("%s %d %s -> %s -> back: distance %d, want %d", tt.stroke, tt.distance, tt.course, to, backDistance, tt.distance)
+			}
+			// Each conversion rounds to hundredths
+			if diff := back - tt.timeMs; diff < -10 || diff > 10 {
+				t.Errorf("%s %d %s -> %s -> back: %d ms, want %d ms", tt.stroke, tt.distance, tt.course, to, back, tt.timeMs)
+			}
+		}
+	}
+}
+
+// TestConvertReference checks conversions against Hy-Tek's published
+// factors: SCY times are multiplied by 1.11 to SCM and turn increments are
+// added from SCM to LCM (0.8s a turn freestyle, 1.0s breaststroke), except
+// for the distance freestyles, which use a single factor from SCY to LCM.
+func TestConvertReference(t *testing.T) {
+	tests := []struct {
+		stroke       string
+		distance     int
+		from, to     string
+		timeMs       int
+		wantDistance int
+		wantMs       int
+	}{
+		// 22.45 x 1.11 + 0.8
+		{"Freestyle", 50, models.CourseSCY, models.CourseLCM, 22450, 50, 25720},
+		// 22.45 x 1.11
+		{"Freestyle", 50, models.CourseSCY, models.CourseSCM, 22450, 50, 24920},
+		// 4:41.34 x 0.8925
+		{"Freestyle", 500, models.CourseSCY, models.CourseLCM, 281340, 400, 251100},
+		// 16:38.76 x 1.02
+		{"Freestyle", 1650, models.CourseSCY, models.CourseLCM, 998760, 1500, 1018740},
+		// 4:11.10 / 0.8925
+		{"Freestyle", 400, models.CourseLCM, models.CourseSCY, 251100, 500, 281340},
+		// (1:12.88 - 2 x 1.0) / 1.11
+		{"Breaststroke", 100, models.CourseLCM, models.CourseSCY, 72880, 100, 63860},
+		// 1:12.88 - 2 x 1.0
+		{"Breaststroke", 100, models.CourseLCM, models.CourseSCM, 72880, 100, 70880},
+		// 2:00.00 + 4 x 0.6
+		{"Backstroke", 200, models.CourseSCM, models.CourseLCM, 120000, 200, 122400},
+	}
+
+	for _, tt := range tests {
+		distance, got, err := Convert(tt.stroke, tt.distance, tt.from, tt.to, tt.timeMs)
+		if err != nil {
+			t.Errorf("Convert(%s %d %s -> %s): %v", tt.stroke, tt.distance, tt.from, tt.to, err)
+			continue
+		}
+		if distance != tt.wantDistance || got != tt.wantMs {
+			t.Errorf("Convert(%s %d %s -> %s, %d) = %d, %d ms; want %d, %d ms",
+				tt.stroke, tt.distance, tt.from, tt.to, tt.timeMs, distance, got, tt.wantDistance, tt.wantMs)
+		}
+	}
+}
+
+func TestEquivalentDistance(t *testing.T) {
+	tests := []struct {
+		stroke   string
+		distance int
+		from, to string
+		want     int
+		wantErr  error
+	}{
+		{"Freestyle", 500, models.CourseSCY, models.CourseLCM, 400, nil},
+		{"Freestyle", 1650, models.CourseSCY, models.CourseSCM, 1500, nil},
+		{"Freestyle", 800, models.CourseLCM, models.CourseSCY, 1000, nil},
+		{"Freestyle", 100, models.CourseLCM, models.CourseSCY, 100, nil},
+		{"Individual Medley", 400, models.CourseLCM, models.CourseSCY, 400, nil},
+		{"Individual Medley", 400, models.CourseSCY, models.CourseLCM, 400, nil},
+		{"Backstroke", 500, models.CourseSCY, models.CourseSCM, 500, nil},
+		{"Individual Medley", 100, models.CourseSCY, models.CourseLCM, 0, ErrUnsupported},
+	}
+
+	for _, tt := range tests {
+		got, err := EquivalentDistance(tt.stroke, tt.distance, tt.from, tt.to)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("EquivalentDistance(%s %d %s -> %s) = %d, %v; want %d, %v",
+				tt.stroke, tt.distance, tt.from, tt.to, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -3,8 +3,11 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"laplogger/models"
 )
 
 func InitDB() (*sql.DB, error) {
@@ -17,6 +20,10 @@ func InitDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	if err := migrateTables(db); err != nil {
+		return nil, err
+	}
+
 	if err := seedData(db); err != nil {
 		return nil, err
 	}
@@ -24,6 +31,36 @@ func InitDB() (*sql.DB, error) {
 	return db, nil
 }
 
+// eventsTableSchema creates the events table under the given name, so the
+// same definition can be used to rebuild it during migration
+const eventsTableSchema = `CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			stroke_id INTEGER NOT NULL,
+			distance INTEGER NOT NULL,
+			units TEXT NOT NULL DEFAULT 'meters',
+			legs INTEGER NOT NULL DEFAULT 1,
+			name TEXT NOT NULL,
+			FOREIGN KEY (stroke_id) REFERENCES strokes(id),
+			UNIQUE(stroke_id, distance, units, legs)
+		)`
+
+// swimmersTableSchema creates the swimmers table under the given name, so
+// the same definition can be used to rebuild it during migration. Emails
+// are unique within each user's swimmers, not across users.
+const swimmersTableSchema = `CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			email TEXT,
+			date_of_birth DATE,
+			gender TEXT,
+			club TEXT,
+			uss_id TEXT,
+			user_id INTEGER REFERENCES users(id),
+			archived_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, email)
+		)`
+
 func createTables(db *sql.DB) error {
 	queries := []string{
 		// Users table
@@ -32,17 +69,15 @@ func createTables(db *sql.DB) error {
 			username TEXT NOT NULL UNIQUE,
 			email TEXT NOT NULL UNIQUE,
 			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL DEFAULT 'coach',
+			time_format TEXT NOT NULL DEFAULT '',
+			time_precision INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
 		// Swimmers table
-		`CREATE TABLE IF NOT EXISTS swimmers (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			email TEXT UNIQUE,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
+		fmt.Sprintf(swimmersTableSchema, "swimmers"),
 
 		// Strokes table
 		`CREATE TABLE IF NOT EXISTS strokes (
@@ -57,18 +92,12 @@ func createTables(db *sql.DB) error {
 			location TEXT NOT NULL,
 			meet_date DATE NOT NULL,
 			description TEXT,
+			user_id INTEGER REFERENCES users(id),
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 
-		// Events table (stroke + distance combinations)
-		`CREATE TABLE IF NOT EXISTS events (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			stroke_id INTEGER NOT NULL,
-			distance INTEGER NOT NULL,
-			name TEXT NOT NULL,
-			FOREIGN KEY (stroke_id) REFERENCES strokes(id),
-			UNIQUE(stroke_id, distance)
-		)`,
+		// Events table (stroke + distance + units combinations, individual or relay)
+		fmt.Sprintf(eventsTableSchema, "events"),
 
 		// Meet Events table (which events are in which meets)
 		`CREATE TABLE IF NOT EXISTS meet_events (
@@ -90,6 +119,11 @@ func createTables(db *sql.DB) error {
 			event_id INTEGER NOT NULL,
 			meet_id INTEGER,
 			time_ms INTEGER NOT NULL,
+			course TEXT NOT NULL DEFAULT 'LCM',
+			start_type TEXT NOT NULL DEFAULT 'flat',
+			status TEXT NOT NULL DEFAULT 'ok',
+			dq_code TEXT,
+			round TEXT NOT NULL DEFAULT '',
 			notes TEXT,
 			recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (swimmer_id) REFERENCES swimmers(id),
@@ -97,11 +131,86 @@ func createTables(db *sql.DB) error {
 			FOREIGN KEY (meet_id) REFERENCES meets(id)
 		)`,
 
+		// Swim Time Audit table (history of changes to swim times)
+		`CREATE TABLE IF NOT EXISTS swim_time_audit (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			swim_time_id INTEGER NOT NULL,
+			swimmer_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			changed_by INTEGER NOT NULL,
+			old_value TEXT,
+			new_value TEXT,
+			changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (changed_by) REFERENCES users(id)
+		)`,
+
+		// Swim Splits table (cumulative intermediate times within a swim)
+		`CREATE TABLE IF NOT EXISTS swim_splits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			swim_time_id INTEGER NOT NULL,
+			split_num INTEGER NOT NULL,
+			distance INTEGER NOT NULL,
+			time_ms INTEGER NOT NULL,
+			FOREIGN KEY (swim_time_id) REFERENCES swim_times(id),
+			UNIQUE(swim_time_id, split_num)
+		)`,
+
+		// Relay Times table (a relay swim; the swimmers are in relay_legs)
+		`CREATE TABLE IF NOT EXISTS relay_times (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			event_id INTEGER NOT NULL,
+			meet_id INTEGER,
+			team_name TEXT,
+			time_ms INTEGER NOT NULL,
+			course TEXT NOT NULL DEFAULT 'LCM',
+			round TEXT NOT NULL DEFAULT '',
+			notes TEXT,
+			recorded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (event_id) REFERENCES events(id),
+			FOREIGN KEY (meet_id) REFERENCES meets(id)
+		)`,
+
+		// Relay Legs table (the swimmers of a relay in swimming order)
+		`CREATE TABLE IF NOT EXISTS relay_legs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			relay_time_id INTEGER NOT NULL,
+			leg_num INTEGER NOT NULL,
+			swimmer_id INTEGER NOT NULL,
+			split_ms INTEGER,
+			FOREIGN KEY (relay_time_id) REFERENCES relay_times(id),
+			FOREIGN KEY (swimmer_id) REFERENCES swimmers(id),
+			UNIQUE(relay_time_id, leg_num)
+		)`,
+
+		// Time Standards table (motivational and qualifying cuts)
+		`CREATE TABLE IF NOT EXISTS time_standards (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			standard_set TEXT NOT NULL,
+			cut_name TEXT NOT NULL,
+			age_group TEXT NOT NULL,
+			gender TEXT NOT NULL,
+			course TEXT NOT NULL,
+			event_id INTEGER NOT NULL,
+			time_ms INTEGER NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (event_id) REFERENCES events(id),
+			UNIQUE(user_id, standard_set, cut_name, age_group, gender, course, event_id)
+		)`,
+
 		// Indexes for better performance
 		`CREATE INDEX IF NOT EXISTS idx_swim_times_swimmer ON swim_times(swimmer_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_swim_times_event ON swim_times(event_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_swim_times_meet ON swim_times(meet_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_swim_times_swimmer_event ON swim_times(swimmer_id, event_id, time_ms)`,
 		`CREATE INDEX IF NOT EXISTS idx_meet_events_meet ON meet_events(meet_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_swim_time_audit_time ON swim_time_audit(swim_time_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_relay_times_user ON relay_times(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_relay_legs_swimmer ON relay_legs(swimmer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_time_standards_event ON time_standards(user_id, event_id, course, gender)`,
 	}
 
 	for _, query := range queries {
@@ -113,19 +222,207 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
-func seedData(db *sql.DB) error {
-	// Check if strokes already exist
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM strokes").Scan(&count)
+// migrateTables upgrades databases created by older versions by adding any
+// columns introduced since, then creates the indexes that depend on them
+func migrateTables(db *sql.DB) error {
+	// Events were once unique on stroke and distance alone, leaving no room
+	// for yard or relay events, so older tables are rebuilt with units and
+	// legs columns. Every existing event is an individual event, and tables
+	// from before yard events only hold meters events.
+	hasLegs, err := hasColumn(db, "events", "legs")
+	if err != nil {
+		return err
+	}
+	if !hasLegs {
+		if err := addColumnIfMissing(db, "events", "units", "TEXT NOT NULL DEFAULT 'meters'"); err != nil {
+			return err
+		}
+		if err := rebuildEventsTable(db); err != nil {
+			return err
+		}
+	}
+
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		// Role granted to the user, carried in their JWT
+		{"users", "role", "TEXT NOT NULL DEFAULT 'coach'"},
+		// How the user prefers times to be written; empty uses the default
+		{"users", "time_format", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "time_precision", "INTEGER NOT NULL DEFAULT 0"},
+		// Owning user for per-user data isolation
+		{"swimmers", "user_id", "INTEGER REFERENCES users(id)"},
+		{"meets", "user_id", "INTEGER REFERENCES users(id)"},
+		// Set when a swimmer leaves the club
+		{"swimmers", "archived_at", "DATETIME"},
+		// Demographics for age group and gender based results
+		{"swimmers", "date_of_birth", "DATE"},
+		{"swimmers", "gender", "TEXT"},
+		{"swimmers", "club", "TEXT"},
+		// USA Swimming registration ID, used to match imported results
+		{"swimmers", "uss_id", "TEXT"},
+		// Pool course the time was swum in
+		{"swim_times", "course", "TEXT NOT NULL DEFAULT 'LCM'"},
+		// Flat or relay start; relay starts don't count toward PBs
+		{"swim_times", "start_type", "TEXT NOT NULL DEFAULT 'flat'"},
+		// Result status, with the infraction code for disqualifications
+		{"swim_times", "status", "TEXT NOT NULL DEFAULT 'ok'"},
+		{"swim_times", "dq_code", "TEXT"},
+		// Round of a meet swim, such as prelims or finals
+		{"swim_times", "round", "TEXT NOT NULL DEFAULT ''"},
+		{"relay_times", "round", "TEXT NOT NULL DEFAULT ''"},
+	}
+
+	for _, c := range columns {
+		if err := addColumnIfMissing(db, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// Swimmer emails were once unique across all users, which let one user
+	// find out which emails another had, so older tables are rebuilt with
+	// emails unique per user
+	perUserEmails, err := hasTableConstraint(db, "swimmers", "UNIQUE(user_id, email)")
 	if err != nil {
 		return err
 	}
+	if !perUserEmails {
+		if err := rebuildSwimmersTable(db); err != nil {
+			return err
+		}
+	}
+
+	queries := []string{
+		// Swimmers and meets from before data was owned by users go to the
+		// first user to register, rather than being hidden from everyone
+		`UPDATE swimmers SET user_id = (SELECT MIN(id) FROM users) WHERE user_id IS NULL`,
+		`UPDATE meets SET user_id = (SELECT MIN(id) FROM users) WHERE user_id IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_swimmers_user ON swimmers(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_swimmers_uss_id ON swimmers(user_id, uss_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_meets_user ON meets(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_swim_times_course ON swim_times(swimmer_id, event_id, course, time_ms)`,
+		// Blank emails are stored as NULL so they don't collide on UNIQUE
+		// (NULL emails never do, and neither do NULL owners)
+		`UPDATE swimmers SET email = NULL WHERE email = ''`,
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already present
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
 
-	// Only seed if no strokes exist
-	if count > 0 {
-		return nil
+// hasColumn reports whether a table has the given column
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
 	}
+	defer rows.Close()
 
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// rebuildEventsTable recreates the events table with the current schema,
+// keeping event IDs so existing times and meet events still refer to them
+func rebuildEventsTable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		fmt.Sprintf(eventsTableSchema, "events_new"),
+		`INSERT INTO events_new (id, stroke_id, distance, units, name)
+			SELECT id, stroke_id, distance, units, name FROM events`,
+		`DROP TABLE events`,
+		`ALTER TABLE events_new RENAME TO events`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// hasTableConstraint reports whether a table's definition includes the
+// given text, such as a UNIQUE constraint
+func hasTableConstraint(db *sql.DB, table, constraint string) (bool, error) {
+	var definition string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&definition)
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(strings.Join(strings.Fields(definition), " "), constraint), nil
+}
+
+// rebuildSwimmersTable recreates the swimmers table with the current schema,
+// keeping swimmer IDs so existing times and relay legs still refer to them
+func rebuildSwimmersTable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const columns = "id, name, email, date_of_birth, gender, club, uss_id, user_id, archived_at, created_at"
+	queries := []string{
+		fmt.Sprintf(swimmersTableSchema, "swimmers_new"),
+		`INSERT INTO swimmers_new (` + columns + `) SELECT ` + columns + ` FROM swimmers`,
+		`DROP TABLE swimmers`,
+		`ALTER TABLE swimmers_new RENAME TO swimmers`,
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// seedData inserts the standard strokes and events. It runs on every start
+// and only adds rows that are missing, so events added in newer versions
+// reach existing databases.
+func seedData(db *sql.DB) error {
 	// Seed strokes
 	strokes := []string{
 		"Freestyle",
@@ -136,7 +433,7 @@ func seedData(db *sql.DB) error {
 	}
 
 	for _, stroke := range strokes {
-		_, err := db.Exec("INSERT INTO strokes (name) VALUES (?)", stroke)
+		_, err := db.Exec("INSERT OR IGNORE INTO strokes (name) VALUES (?)", stroke)
 		if err != nil {
 			return err
 		}
@@ -146,24 +443,60 @@ func seedData(db *sql.DB) error {
 	events := []struct {
 		strokeName string
 		distance   int
+		units      string
+		legs       int
 	}{
-		{"Freestyle", 50},
-		{"Freestyle", 100},
-		{"Freestyle", 200},
-		{"Freestyle", 400},
-		{"Freestyle", 800},
-		{"Freestyle", 1500},
-		{"Backstroke", 50},
-		{"Backstroke", 100},
-		{"Backstroke", 200},
-		{"Breaststroke", 50},
-		{"Breaststroke", 100},
-		{"Breaststroke", 200},
-		{"Butterfly", 50},
-		{"Butterfly", 100},
-		{"Butterfly", 200},
-		{"Individual Medley", 200},
-		{"Individual Medley", 400},
+		// Meters events (SCM and LCM)
+		{"Freestyle", 50, models.UnitsMeters, 1},
+		{"Freestyle", 100, models.UnitsMeters, 1},
+		{"Freestyle", 200, models.UnitsMeters, 1},
+		{"Freestyle", 400, models.UnitsMeters, 1},
+		{"Freestyle", 800, models.UnitsMeters, 1},
+		{"Freestyle", 1500, models.UnitsMeters, 1},
+		{"Backstroke", 50, models.UnitsMeters, 1},
+		{"Backstroke", 100, models.UnitsMeters, 1},
+		{"Backstroke", 200, models.UnitsMeters, 1},
+		{"Breaststroke", 50, models.UnitsMeters, 1},
+		{"Breaststroke", 100, models.UnitsMeters, 1},
+		{"Breaststroke", 200, models.UnitsMeters, 1},
+		{"Butterfly", 50, models.UnitsMeters, 1},
+		{"Butterfly", 100, models.UnitsMeters, 1},
+		{"Butterfly", 200, models.UnitsMeters, 1},
+		{"Individual Medley", 200, models.UnitsMeters, 1},
+		{"Individual Medley", 400, models.UnitsMeters, 1},
+
+		// Yards events (SCY)
+		{"Freestyle", 50, models.UnitsYards, 1},
+		{"Freestyle", 100, models.UnitsYards, 1},
+		{"Freestyle", 200, models.UnitsYards, 1},
+		{"Freestyle", 500, models.UnitsYards, 1},
+		{"Freestyle", 1000, models.UnitsYards, 1},
+		{"Freestyle", 1650, models.UnitsYards, 1},
+		{"Backstroke", 50, models.UnitsYards, 1},
+		{"Backstroke", 100, models.UnitsYards, 1},
+		{"Backstroke", 200, models.UnitsYards, 1},
+		{"Breaststroke", 50, models.UnitsYards, 1},
+		{"Breaststroke", 100, models.UnitsYards, 1},
+		{"Breaststroke", 200, models.UnitsYards, 1},
+		{"Butterfly", 50, models.UnitsYards, 1},
+		{"Butterfly", 100, models.UnitsYards, 1},
+		{"Butterfly", 200, models.UnitsYards, 1},
+		{"Individual Medley", 100, models.UnitsYards, 1},
+		{"Individual Medley", 200, models.UnitsYards, 1},
+		{"Individual Medley", 400, models.UnitsYards, 1},
+
+		// Relay events; the distance is the total over all four legs and
+		// medley relays are stored under the Individual Medley stroke
+		{"Freestyle", 200, models.UnitsMeters, 4},
+		{"Freestyle", 400, models.UnitsMeters, 4},
+		{"Freestyle", 800, models.UnitsMeters, 4},
+		{models.RelayStrokeMedley, 200, models.UnitsMeters, 4},
+		{models.RelayStrokeMedley, 400, models.UnitsMeters, 4},
+		{"Freestyle", 200, models.UnitsYards, 4},
+		{"Freestyle", 400, models.UnitsYards, 4},
+		{"Freestyle", 800, models.UnitsYards, 4},
+		{models.RelayStrokeMedley, 200, models.UnitsYards, 4},
+		{models.RelayStrokeMedley, 400, models.UnitsYards, 4},
 	}
 
 	for _, event := range events {
@@ -175,11 +508,12 @@ func seedData(db *sql.DB) error {
 		}
 
 		// Create event name
-		eventName := fmt.Sprintf("%dm %s", event.distance, event.strokeName)
+		e := models.Event{StrokeID: strokeID, Distance: event.distance, Units: event.units, Legs: event.legs}
+		eventName := e.GenerateEventName(event.strokeName)
 
 		// Insert event
-		_, err = db.Exec("INSERT INTO events (stroke_id, distance, name) VALUES (?, ?, ?)",
-			strokeID, event.distance, eventName)
+		_, err = db.Exec("INSERT OR IGNORE INTO events (stroke_id, distance, units, legs, name) VALUES (?, ?, ?, ?, ?)",
+			strokeID, event.distance, event.units, event.legs, eventName)
 		if err != nil {
 			return err
 		}
@@ -9,6 +9,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"laplogger/middleware"
 	"laplogger/models"
 )
 
@@ -58,8 +59,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	// Insert user
 	result, err := h.db.Exec(
-		"INSERT INTO users (username, email, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		req.Username, req.Email, string(hashedPassword), time.Now(), time.Now(),
+		"INSERT INTO users (username, email, password_hash, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		req.Username, req.Email, string(hashedPassword), models.RoleCoach, time.Now(), time.Now(),
 	)
 	if err != nil {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
@@ -77,12 +78,13 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		ID:        int(userID),
 		Username:  req.Username,
 		Email:     req.Email,
+		Role:      models.RoleCoach,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
 	// Generate JWT token
-	token, err := h.generateToken(user.ID, user.Username)
+	token, err := h.generateToken(user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -116,9 +118,9 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	var passwordHash string
 	err := h.db.QueryRow(
-		"SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE username = ?",
+		"SELECT id, username, email, password_hash, role, created_at, updated_at FROM users WHERE username = ?",
 		req.Username,
-	).Scan(&user.ID, &user.Username, &user.Email, &passwordHash, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &passwordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
@@ -136,7 +138,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate JWT token
-	token, err := h.generateToken(user.ID, user.Username)
+	token, err := h.generateToken(user)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -152,11 +154,24 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// Me returns the authenticated caller
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
 // generateToken creates a JWT token for the user
-func (h *AuthHandler) generateToken(userID int, username string) (string, error) {
+func (h *AuthHandler) generateToken(user models.User) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
+		"user_id":  user.ID,
+		"username": user.Username,
+		"roles":    []string{user.Role},
 		"exp":      time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
 		"iat":      time.Now().Unix(),
 	}
@@ -184,3 +199,14 @@ func (h *AuthHandler) ValidateToken(tokenString string) (*jwt.MapClaims, error)
 
 	return nil, jwt.ErrInvalidKey
 }
+
+// currentUserID returns the authenticated caller's user ID, writing a 401
+// response when the request carries no user
+func currentUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+	return user.ID, true
+}
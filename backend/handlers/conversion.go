@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"laplogger/conversion"
+	"laplogger/models"
+)
+
+// GetTimeConversions returns a time converted to each of the other courses.
+// Courses without an equivalent event (such as 100 IM in LCM) are omitted.
+func (h *TimeHandler) GetTimeConversions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + " WHERE st.id = ? AND s.user_id = ?"
+	timeDetails, err := scanTimeWithDetails(h.db.QueryRow(query, id, userID), format)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.TimeConversionsResponse{
+		Time:        *timeDetails,
+		Conversions: []models.TimeConversion{},
+	}
+
+	for _, course := range models.Courses {
+		if course == timeDetails.Course {
+			continue
+		}
+
+		converted, err := convertTime(h.db, timeDetails, course, format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if converted != nil {
+			response.Conversions = append(response.Conversions, *converted)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// convertTime converts a time to the equivalent event in another course. It
+// returns nil when the event has no equivalent in that course or the result
+// has no time.
+func convertTime(db *sql.DB, t *models.SwimTimeWithDetails, course string, format models.TimeFormat) (*models.TimeConversion, error) {
+	if t.TimeMs == 0 {
+		return nil, nil
+	}
+
+	distance, timeMs, err := conversion.Convert(t.StrokeName, t.Distance, t.Course, course, t.TimeMs)
+	if err == conversion.ErrUnsupported {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	converted := models.TimeConversion{
+		Course:   course,
+		Distance: distance,
+		Units:    models.CourseUnits(course),
+		TimeMs:   timeMs,
+	}
+
+	err = db.QueryRow(`
+		SELECT e.id, e.name
+		FROM events e
+		JOIN strokes s ON e.stroke_id = s.id
+		WHERE s.name = ? AND e.distance = ? AND e.units = ? AND e.legs = 1`,
+		t.StrokeName, distance, converted.Units).Scan(&converted.EventID, &converted.EventName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	converted.FormattedTime = format.Format(timeMs)
+
+	return &converted, nil
+}
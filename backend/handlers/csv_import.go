@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// csvField is a field read from an import CSV, with the column headers it is
+// found under when the request doesn't map it to a column
+type csvField struct {
+	name     string
+	headers  []string
+	required bool
+}
+
+var swimmerCSVFields = []csvField{
+	{name: "name", headers: []string{"name", "swimmer", "swimmer name", "full name"}, required: true},
+	{name: "email", headers: []string{"email", "e mail", "email address"}},
+	{name: "date_of_birth", headers: []string{"date of birth", "dob", "birth date", "birthdate", "birthday"}},
+	{name: "gender", headers: []string{"gender", "sex"}},
+	{name: "club", headers: []string{"club", "team"}},
+	{name: "uss_id", headers: []string{"uss id", "usa swimming id", "registration id", "member id"}},
+}
+
+var timeCSVFields = []csvField{
+	{name: "swimmer", headers: []string{"swimmer", "name", "swimmer name", "full name"}},
+	{name: "swimmer_id", headers: []string{"swimmer id"}},
+	{name: "email", headers: []string{"email", "e mail", "swimmer email"}},
+	{name: "uss_id", headers: []string{"uss id", "usa swimming id", "registration id", "member id"}},
+	{name: "event", headers: []string{"event", "event name"}, required: true},
+	{name: "course", headers: []string{"course"}},
+	{name: "time", headers: []string{"time", "swim time", "final time"}},
+	{name: "status", headers: []string{"status", "result"}},
+	{name: "dq_code", headers: []string{"dq code", "dq"}},
+	{name: "start_type", headers: []string{"start type", "start"}},
+	{name: "meet", headers: []string{"meet", "meet name"}},
+	{name: "date", headers: []string{"date", "swim date", "recorded at"}},
+	{name: "notes", headers: []string{"notes", "note"}},
+}
+
+// ImportSwimmersCSV adds swimmers from a CSV file with a header row. Columns
+// are found by their headers, such as "Name", "DOB" or "Email", and
+// ?mapping= (or a "mapping" form field) can name the column of any field as
+// a JSON object, e.g. {"name":"Athlete"}. Emails may not match another of
+// the caller's swimmers, ignoring case. With ?dry_run=true the file is only checked;
+// otherwise it is saved only when every row is valid.
+func (h *ImportHandler) ImportSwimmersCSV(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	reader, columns, err := openCSVImport(r, swimmerCSVFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer reader.Close()
+
+	result := newCSVImportResult(r, columns)
+	var swimmers []models.Swimmer
+	var lines []int                // Line of each swimmer
+	emails := make(map[string]int) // Line of each email in the file
+	err = reader.each(result, func(line int, row csvRow) error {
+		swimmer := models.Swimmer{
+			Name:   row.get("name"),
+			Email:  row.get("email"),
+			Gender: row.get("gender"),
+			Club:   row.get("club"),
+			USSID:  row.get("uss_id"),
+		}
+		var err error
+		if swimmer.DateOfBirth, err = parseDateOfBirth(row.get("date_of_birth")); err != nil {
+			return rowError{err}
+		}
+		if err := validateSwimmer(&swimmer); err != nil {
+			return rowError{err}
+		}
+
+		if swimmer.Email != "" {
+			email := strings.ToLower(swimmer.Email)
+			if other, ok := emails[email]; ok {
+				return rowError{fmt.Errorf("Email %s is also given on line %d", swimmer.Email, other)}
+			}
+			emails[email] = line
+
+			var count int
+			err := h.db.QueryRow("SELECT COUNT(*) FROM swimmers WHERE user_id = ? AND email = ? COLLATE NOCASE",
+				userID, swimmer.Email).Scan(&count)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return rowError{fmt.Errorf("A swimmer with email %s already exists", swimmer.Email)}
+			}
+		}
+
+		swimmers = append(swimmers, swimmer)
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.saveCSVImport(w, result, len(swimmers), func(tx *sql.Tx) error {
+		for i, swimmer := range swimmers {
+			_, err := tx.Exec(
+				"INSERT INTO swimmers (name, email, date_of_birth, gender, club, uss_id, user_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				swimmer.Name, nullableString(swimmer.Email), nullableDate(swimmer.DateOfBirth),
+				nullableString(swimmer.Gender), nullableString(swimmer.Club), nullableString(swimmer.USSID), userID)
+			// A swimmer with the email may have been added since the file was checked
+			if isUniqueViolation(err) {
+				result.Errors = append(result.Errors, models.ImportError{
+					Line:    lines[i],
+					Message: fmt.Sprintf("A swimmer with email %s already exists", swimmer.Email),
+				})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// csvTime is a valid row of a times CSV
+type csvTime struct {
+	req  models.CreateTimeRequest
+	date *time.Time
+}
+
+// ImportTimesCSV records times from a CSV file with a header row, mapped to
+// columns as ImportSwimmersCSV does. Each row names an existing swimmer by
+// swimmer ID, email, USA Swimming ID or name, and an event such as
+// "100 Free" with its course, or with units such as "100y Free". A row may
+// name one of the caller's meets, and its date defaults to the meet's.
+// Times are checked as POST /api/times checks them.
+func (h *ImportHandler) ImportTimesCSV(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	reader, columns, err := openCSVImport(r, timeCSVFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer reader.Close()
+	if columns["swimmer"] == "" && columns["swimmer_id"] == "" && columns["email"] == "" && columns["uss_id"] == "" {
+		http.Error(w, "A swimmer, swimmer_id, email or uss_id column is required", http.StatusBadRequest)
+		return
+	}
+
+	events, err := eventsByKey(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	swimmers, err := loadCSVSwimmers(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meets, err := loadCSVMeets(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := newCSVImportResult(r, columns)
+	result.UnknownEvents = []string{}
+	unknown := make(map[string]bool)
+	var times []csvTime
+	err = reader.each(result, func(line int, row csvRow) error {
+		swimmerID, err := swimmers.find(row)
+		if err != nil {
+			return rowError{err}
+		}
+
+		eventID, course, err := csvEvent(row.get("event"), row.get("course"), events)
+		if errors.Is(err, errUnknownEvent) {
+			event := row.get("event")
+			if !unknown[event] {
+				unknown[event] = true
+				result.UnknownEvents = append(result.UnknownEvents, event)
+			}
+		}
+		if err != nil {
+			return rowError{err}
+		}
+
+		t := csvTime{req: models.CreateTimeRequest{
+			SwimmerID: swimmerID,
+			EventID:   eventID,
+			Time:      row.get("time"),
+			Course:    course,
+			StartType: strings.ToLower(row.get("start_type")),
+			Status:    row.get("status"),
+			DQCode:    row.get("dq_code"),
+			Notes:     row.get("notes"),
+		}}
+		if name := row.get("meet"); name != "" {
+			meet, err := meets.find(name)
+			if err != nil {
+				return rowError{err}
+			}
+			t.req.MeetID = &meet.ID
+			t.date = &meet.MeetDate
+		}
+		if value := row.get("date"); value != "" {
+			date, err := parseDate(value)
+			if err != nil {
+				return rowError{errors.New("Date must be an ISO date (YYYY-MM-DD)")}
+			}
+			t.date = &date
+		}
+
+		if _, status, err := validateTimeRequest(h.db, &t.req, userID); err != nil {
+			if status == http.StatusInternalServerError {
+				return err
+			}
+			return rowError{err}
+		}
+		times = append(times, t)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.saveCSVImport(w, result, len(times), func(tx *sql.Tx) error {
+		for _, t := range times {
+			var recordedAt interface{}
+			if t.date != nil {
+				recordedAt = *t.date
+			}
+			res, err := tx.Exec(`
+				INSERT INTO swim_times (swimmer_id, event_id, meet_id, time_ms, course, start_type, status, dq_code, notes, recorded_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP))`,
+				t.req.SwimmerID, t.req.EventID, t.req.MeetID, t.req.TimeMs, t.req.Course, t.req.StartType,
+				t.req.Status, nullableString(t.req.DQCode), t.req.Notes, recordedAt)
+			if err != nil {
+				return err
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			created, err := getSwimTime(tx, int(id), userID)
+			if err != nil {
+				return err
+			}
+			if err := recordTimeAudit(tx, models.AuditActionCreate, userID, nil, created); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveCSVImport saves the valid rows of an import with save, unless it is a
+// dry run or any row has an error, and responds with the report. Rows save
+// finds errors in are added to the report, and nothing is saved.
+func (h *ImportHandler) saveCSVImport(w http.ResponseWriter, result *models.CSVImportResult, valid int, save func(*sql.Tx) error) {
+	result.Created = valid
+
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		if !result.DryRun {
+			status = http.StatusBadRequest
+			result.Created = 0
+		}
+	} else if !result.DryRun {
+		tx, err := h.db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if err := save(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(result.Errors) > 0 {
+			status = http.StatusBadRequest
+			result.Created = 0
+		} else if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func newCSVImportResult(r *http.Request, columns map[string]string) *models.CSVImportResult {
+	return &models.CSVImportResult{
+		DryRun:  isDryRun(r),
+		Columns: columns,
+		Errors:  []models.ImportError{},
+	}
+}
+
+// csvImport reads the data rows of an uploaded CSV
+type csvImport struct {
+	file    io.Closer
+	reader  *csv.Reader
+	indexes map[string]int // Column of each field found
+}
+
+// csvRow is a data row of an import CSV
+type csvRow struct {
+	record  []string
+	indexes map[string]int
+}
+
+// get returns a field of the row, or "" when the file has no column for it
+func (row csvRow) get(field string) string {
+	i, ok := row.indexes[field]
+	if !ok || i >= len(row.record) {
+		return ""
+	}
+	return strings.TrimSpace(row.record[i])
+}
+
+// rowError is an error in a row's data, reported against the row rather
+// than failing the import
+type rowError struct {
+	err error
+}
+
+func (e rowError) Error() string { return e.err.Error() }
+
+// openCSVImport opens the CSV sent with an import request and finds the
+// column of each field from its header row and the request's mapping. It
+// returns the header each field was read from.
+func openCSVImport(r *http.Request, fields []csvField) (*csvImport, map[string]string, error) {
+	mapping, err := columnMapping(r, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := uploadedFile(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		file.Close()
+		return nil, nil, errors.New("The file is empty")
+	} else if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("Invalid header row: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	headers := make(map[string]int)
+	for i, h := range header {
+		if _, ok := headers[csvHeader(h)]; !ok {
+			headers[csvHeader(h)] = i
+		}
+	}
+
+	indexes := make(map[string]int)
+	columns := make(map[string]string)
+	for _, field := range fields {
+		if mapped, ok := mapping[field.name]; ok {
+			i, found := headers[csvHeader(mapped)]
+			if !found {
+				file.Close()
+				return nil, nil, fmt.Errorf("The %s column %q is not in the header", field.name, mapped)
+			}
+			indexes[field.name], columns[field.name] = i, header[i]
+			continue
+		}
+		for _, h := range field.headers {
+			if i, found := headers[h]; found {
+				indexes[field.name], columns[field.name] = i, header[i]
+				break
+			}
+		}
+		if _, found := indexes[field.name]; !found && field.required {
+			file.Close()
+			return nil, nil, fmt.Errorf("No %s column was found; name it with mapping", field.name)
+		}
+	}
+
+	return &csvImport{file: file, reader: reader, indexes: indexes}, columns, nil
+}
+
+// columnMapping reads the JSON object mapping fields to column headers, sent
+// as ?mapping= or as the "mapping" field of a multipart form
+func columnMapping(r *http.Request, fields []csvField) (map[string]string, error) {
+	value := r.URL.Query().Get("mapping")
+	if value == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		value = r.FormValue("mapping")
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+		return nil, errors.New(`Mapping must be a JSON object of fields and column headers, e.g. {"name":"Athlete"}`)
+	}
+	for name := range mapping {
+		known := false
+		for _, field := range fields {
+			known = known || field.name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown field %q in mapping", name)
+		}
+	}
+	return mapping, nil
+}
+
+// csvHeader normalizes a column header for comparison, so "Date_of_Birth"
+// matches "date of birth"
+func csvHeader(header string) string {
+	header = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(header))
+	return strings.Join(strings.Fields(header), " ")
+}
+
+func (c *csvImport) Close() error {
+	return c.file.Close()
+}
+
+// each calls fn with every data row, reporting rows that cannot be read and
+// the rowErrors fn returns in the result. Any other error from fn stops the
+// import.
+func (c *csvImport) each(result *models.CSVImportResult, fn func(line int, row csvRow) error) error {
+	for {
+		record, err := c.reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Rows++
+			result.Errors = append(result.Errors, models.ImportError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		line, _ := c.reader.FieldPos(0)
+		result.Rows++
+		err = fn(line, csvRow{record: record, indexes: c.indexes})
+		var rowErr rowError
+		if errors.As(err, &rowErr) {
+			result.Errors = append(result.Errors, models.ImportError{Line: line, Message: rowErr.Error()})
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// csvEvent finds the individual event a row names, such as "100 Free" or
+// "100y Free", and the course it was swum in. The course may be left out
+// when the event gives its units.
+func csvEvent(name, course string, events map[eventKey]int) (int, string, error) {
+	distance, units, stroke, ok := models.ParseEventName(name)
+	if !ok {
+		return 0, "", fmt.Errorf("%w %q", errUnknownEvent, name)
+	}
+
+	if course != "" {
+		parsed, ok := models.ParseCourse(course)
+		if !ok {
+			return 0, "", fmt.Errorf("Invalid course %q", course)
+		}
+		if units != "" && units != models.CourseUnits(parsed) {
+			return 0, "", fmt.Errorf("Event %q is not swum in %s", name, parsed)
+		}
+		course, units = parsed, models.CourseUnits(parsed)
+	} else if units == "" {
+		return 0, "", fmt.Errorf("Event %q needs a course, or units such as %dy or %dm", name, distance, distance)
+	}
+
+	eventID, ok := events[eventKey{distance, units, stroke, 1}]
+	if !ok {
+		return 0, "", fmt.Errorf("%w %q", errUnknownEvent, name)
+	}
+	return eventID, course, nil
+}
+
+// csvSwimmer is one of the caller's swimmers, with the fields times CSV rows
+// are matched against normalized
+type csvSwimmer struct {
+	id    int
+	name  string // Normalized with matchingName
+	email string // Lowercase
+	ussID string
+}
+
+type csvSwimmers []csvSwimmer
+
+func loadCSVSwimmers(db *sql.DB, userID int) (csvSwimmers, error) {
+	rows, err := db.Query("SELECT "+swimmerColumns+" FROM swimmers WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var swimmers csvSwimmers
+	for rows.Next() {
+		s, err := scanSwimmer(rows)
+		if err != nil {
+			return nil, err
+		}
+		swimmers = append(swimmers, csvSwimmer{id: s.ID, name: matchingName(s.Name), ussID: s.USSID, email: strings.ToLower(s.Email)})
+	}
+	return swimmers, rows.Err()
+}
+
+// find returns the swimmer a row names by swimmer ID, email, USA Swimming
+// ID or name, in that order
+func (swimmers csvSwimmers) find(row csvRow) (int, error) {
+	var field, value string
+	var match func(s csvSwimmer) bool
+	switch {
+	case row.get("swimmer_id") != "":
+		field, value = "ID", row.get("swimmer_id")
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid swimmer ID %q", value)
+		}
+		match = func(s csvSwimmer) bool { return s.id == id }
+	case row.get("email") != "":
+		field, value = "email", row.get("email")
+		match = func(s csvSwimmer) bool { return s.email == strings.ToLower(value) }
+	case row.get("uss_id") != "":
+		field, value = "USA Swimming ID", row.get("uss_id")
+		match = func(s csvSwimmer) bool { return s.ussID == strings.ToUpper(value) }
+	case row.get("swimmer") != "":
+		field, value = "name", row.get("swimmer")
+		match = func(s csvSwimmer) bool { return s.name == matchingName(value) }
+	default:
+		return 0, errors.New("Swimmer is required")
+	}
+
+	id := 0
+	for _, s := range swimmers {
+		if !match(s) {
+			continue
+		}
+		if id != 0 {
+			return 0, fmt.Errorf("Several swimmers have the %s %s; give their email or USA Swimming ID", field, value)
+		}
+		id = s.id
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("No swimmer has the %s %s", field, value)
+	}
+	return id, nil
+}
+
+// csvMeets are the caller's meets, which times CSV rows are matched to by name
+type csvMeets []models.Meet
+
+func loadCSVMeets(db *sql.DB, userID int) (csvMeets, error) {
+	rows, err := db.Query("SELECT id, name, meet_date FROM meets WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meets csvMeets
+	for rows.Next() {
+		var meet models.Meet
+		if err := rows.Scan(&meet.ID, &meet.Name, &meet.MeetDate); err != nil {
+			return nil, err
+		}
+		meets = append(meets, meet)
+	}
+	return meets, rows.Err()
+}
+
+// find returns the meet with a name, ignoring case
+func (meets csvMeets) find(name string) (*models.Meet, error) {
+	var found *models.Meet
+	for i, meet := range meets {
+		if matchingName(meet.Name) != matchingName(name) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("Several meets are named %q", name)
+		}
+		found = &meets[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No meet is named %q", name)
+	}
+	return found, nil
+}
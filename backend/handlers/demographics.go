@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// demographicFilter holds the optional ?gender=, ?age_group=, ?min_age= and
+// ?max_age= filters shared by the swimmer and time lists. Swimmers without
+// a date of birth never match an age filter.
+type demographicFilter struct {
+	gender   string
+	ageGroup string
+	minAge   *int
+	maxAge   *int
+}
+
+// parseDemographicFilter reads the demographic filters from the query string
+func parseDemographicFilter(r *http.Request) (demographicFilter, error) {
+	query := r.URL.Query()
+	var filter demographicFilter
+
+	gender, ok := models.ParseGender(query.Get("gender"))
+	if !ok {
+		return filter, errors.New("Gender must be F, M or X")
+	}
+	filter.gender = gender
+
+	if value := query.Get("age_group"); value != "" {
+		filter.ageGroup = strings.ToUpper(strings.TrimSpace(value))
+		if !slices.Contains(models.AgeGroups, filter.ageGroup) {
+			return filter, errors.New("Age group must be one of " + strings.Join(models.AgeGroups, ", "))
+		}
+	}
+
+	for _, bound := range []struct {
+		param string
+		dest  **int
+	}{{"min_age", &filter.minAge}, {"max_age", &filter.maxAge}} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		age, err := strconv.Atoi(value)
+		if err != nil || age < 0 {
+			return filter, errors.New("Ages must be whole numbers")
+		}
+		*bound.dest = &age
+	}
+
+	return filter, nil
+}
+
+// matches reports whether a swimmer of the given gender and age passes the filter
+func (f demographicFilter) matches(gender string, age *int) bool {
+	if f.gender != "" && gender != f.gender {
+		return false
+	}
+	if f.ageGroup == "" && f.minAge == nil && f.maxAge == nil {
+		return true
+	}
+	if age == nil {
+		return false
+	}
+	if f.ageGroup != "" && models.AgeGroup(*age) != f.ageGroup {
+		return false
+	}
+	if f.minAge != nil && *age < *f.minAge {
+		return false
+	}
+	return f.maxAge == nil || *age <= *f.maxAge
+}
+
+// ageDate returns the date swimmer ages are computed on: the date in
+// ?age_on=, the date of the meet in ?meet_id=, or today. On failure it
+// returns the HTTP status to respond with.
+func ageDate(db *sql.DB, r *http.Request, userID int) (time.Time, int, error) {
+	if value := r.URL.Query().Get("age_on"); value != "" {
+		date, err := parseDate(value)
+		if err != nil {
+			return time.Time{}, http.StatusBadRequest, errors.New("Age on must be an ISO date (YYYY-MM-DD)")
+		}
+		return date, 0, nil
+	}
+
+	if value := r.URL.Query().Get("meet_id"); value != "" {
+		meetID, err := strconv.Atoi(value)
+		if err != nil {
+			return time.Time{}, http.StatusBadRequest, errors.New("Invalid meet ID")
+		}
+		var meetDate time.Time
+		err = db.QueryRow("SELECT meet_date FROM meets WHERE id = ? AND user_id = ?", meetID, userID).Scan(&meetDate)
+		if err == sql.ErrNoRows {
+			return time.Time{}, http.StatusNotFound, errors.New("Meet not found")
+		} else if err != nil {
+			return time.Time{}, http.StatusInternalServerError, err
+		}
+		return meetDate, 0, nil
+	}
+
+	return time.Now(), 0, nil
+}
+
+// parseDateOfBirth parses an optional date of birth, which cannot be in the future
+func parseDateOfBirth(value string) (*time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	dob, err := parseDate(value)
+	if err != nil {
+		return nil, errors.New("Date of birth must be an ISO date (YYYY-MM-DD)")
+	}
+	if dob.After(time.Now()) {
+		return nil, errors.New("Date of birth cannot be in the future")
+	}
+	return &dob, nil
+}
+
+// nullableDate stores a missing date as NULL
+func nullableDate(date *time.Time) sql.NullString {
+	if date == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: date.Format(dateLayout), Valid: true}
+}
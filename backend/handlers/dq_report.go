@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"laplogger/models"
+)
+
+// GetDQReport summarizes how often each of the caller's swimmers is
+// disqualified, with a breakdown by infraction. Only swimmers with at least
+// one result are listed, most disqualifications first. ?swimmer_id= limits
+// the report to one swimmer.
+func (h *TimeHandler) GetDQReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	swimmerID := 0
+	if value := r.URL.Query().Get("swimmer_id"); value != "" {
+		var err error
+		if swimmerID, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.getDQReport(userID, swimmerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Helper function to build the DQ report, for every swimmer when swimmerID is 0
+func (h *TimeHandler) getDQReport(userID, swimmerID int) ([]models.DQReportEntry, error) {
+	rows, err := h.db.Query(`
+		SELECT s.id, s.name,
+			SUM(CASE WHEN st.status IN ('ok', 'dq', 'dnf') THEN 1 ELSE 0 END) AS started,
+			SUM(CASE WHEN st.status = 'dq' THEN 1 ELSE 0 END) AS dq_count,
+			SUM(CASE WHEN st.status = 'dnf' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN st.status = 'dns' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN st.status = 'scratch' THEN 1 ELSE 0 END)
+		FROM swim_times st
+		JOIN swimmers s ON st.swimmer_id = s.id
+		WHERE s.user_id = ? AND (? = 0 OR s.id = ?)
+		GROUP BY s.id, s.name
+		ORDER BY dq_count DESC, s.name`, userID, swimmerID, swimmerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []models.DQReportEntry{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var entry models.DQReportEntry
+		err := rows.Scan(&entry.SwimmerID, &entry.SwimmerName, &entry.Started,
+			&entry.DQCount, &entry.DNFCount, &entry.DNSCount, &entry.Scratches)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Started > 0 {
+			entry.DQPct = math.Round(float64(entry.DQCount)/float64(entry.Started)*10000) / 100
+		}
+		entry.Infractions = []models.InfractionCount{}
+		index[entry.SwimmerID] = len(report)
+		report = append(report, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = h.db.Query(`
+		SELECT st.swimmer_id, COALESCE(st.dq_code, '') AS code, COUNT(*) AS dq_count
+		FROM swim_times st
+		JOIN swimmers s ON st.swimmer_id = s.id
+		WHERE s.user_id = ? AND (? = 0 OR s.id = ?) AND st.status = 'dq'
+		GROUP BY st.swimmer_id, code
+		ORDER BY dq_count DESC, code`, userID, swimmerID, swimmerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var code string
+		if err := rows.Scan(&id, &code, &count); err != nil {
+			return nil, err
+		}
+		infraction, ok := models.LookupInfraction(code)
+		if !ok {
+			infraction = models.Infraction{Code: code}
+		}
+		entry := &report[index[id]]
+		entry.Infractions = append(entry.Infractions, models.InfractionCount{Infraction: infraction, Count: count})
+	}
+
+	return report, rows.Err()
+}
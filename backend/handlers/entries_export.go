@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+	"laplogger/sdif"
+)
+
+// ExportSDIFEntries writes the chosen swimmers' entries in a meet as an SDIF
+// registration file for the host club. Each swimmer is entered in every
+// individual event of the meet's program they have a seed time for: their
+// fastest valid flat-start time before the meet (and on or after ?since= when
+// given), preferring times in the meet's course.
+func (h *MeetEventHandler) ExportSDIFEntries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MeetEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meet, err := getMeet(h.db, meetID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries, status, err := h.buildMeetEntries(meet, &req, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var file bytes.Buffer
+	if err := sdif.WriteEntries(&file, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="meet-%d-entries.sd3"`, meet.ID))
+	w.Write(file.Bytes())
+}
+
+// buildMeetEntries validates an entries request and picks each swimmer's
+// seed times for the meet's program
+func (h *MeetEventHandler) buildMeetEntries(meet *models.Meet, req *models.MeetEntriesRequest, userID int) (*models.MeetEntries, int, error) {
+	if len(req.SwimmerIDs) == 0 {
+		return nil, http.StatusBadRequest, errors.New("Swimmer IDs are required")
+	}
+	course, ok := models.ParseCourse(req.Course)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("Course must be SCY, SCM or LCM")
+	}
+	teamCode := strings.ToUpper(strings.TrimSpace(req.TeamCode))
+	if teamCode == "" || len(teamCode) > 6 {
+		return nil, http.StatusBadRequest, errors.New("Team code is required and must be at most 6 characters")
+	}
+	since := ""
+	if req.Since != "" {
+		date, err := parseDate(req.Since)
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("Since must be an ISO date (YYYY-MM-DD)")
+		}
+		since = date.Format(dateLayout)
+	}
+
+	// USA Swimming entries need each swimmer's birth date and gender
+	swimmers := make(map[int]*models.Swimmer)
+	var swimmerIDs []interface{}
+	clubs := make(map[string]bool)
+	for _, id := range req.SwimmerIDs {
+		if swimmers[id] != nil {
+			continue
+		}
+		swimmer, err := getSwimmer(h.db, id, userID)
+		if err == sql.ErrNoRows {
+			return nil, http.StatusBadRequest, fmt.Errorf("Swimmer %d not found", id)
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if swimmer.DateOfBirth == nil || swimmer.Gender == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("%s needs a date of birth and gender to be entered", swimmer.Name)
+		}
+		swimmer.SetAgeOn(meet.MeetDate)
+		swimmers[id] = swimmer
+		swimmerIDs = append(swimmerIDs, id)
+		clubs[swimmer.Club] = true
+	}
+
+	teamName := strings.TrimSpace(req.TeamName)
+	if teamName == "" {
+		for club := range clubs {
+			teamName = club
+		}
+		if len(clubs) != 1 || teamName == "" {
+			return nil, http.StatusBadRequest, errors.New("Team name is required when the swimmers don't share a club")
+		}
+	}
+
+	// Each event is entered once, in the first session it is swum in
+	rows, err := h.db.Query(`
+		SELECT me.event_id, me.event_num, e.name, e.distance, e.units, s.name
+		FROM meet_events me
+		JOIN events e ON me.event_id = e.id
+		JOIN strokes s ON e.stroke_id = s.id
+		WHERE me.meet_id = ? AND e.legs = 1
+		ORDER BY `+sessionOrder+`, me.session, me.event_num`, meet.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	var program []models.MeetEntry
+	eventIDs := make(map[int]int) // Index in program by event ID
+	for rows.Next() {
+		var entry models.MeetEntry
+		var eventID int
+		var eventName, units string
+		if err := rows.Scan(&eventID, &entry.EventNum, &eventName, &entry.Distance, &units, &entry.Stroke); err != nil {
+			rows.Close()
+			return nil, http.StatusInternalServerError, err
+		}
+		if units != models.CourseUnits(course) {
+			rows.Close()
+			return nil, http.StatusBadRequest, fmt.Errorf("The program's %s is not a %s event", eventName, course)
+		}
+		if _, ok := eventIDs[eventID]; ok {
+			continue
+		}
+		eventIDs[eventID] = len(program)
+		program = append(program, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	seeds := make([][]models.MeetEntry, len(program))
+	args := append([]interface{}{course}, swimmerIDs...)
+	args = append(args, meet.ID, meet.MeetDate.Format(dateLayout), since, since)
+	rows, err = h.db.Query(`
+		SELECT swimmer_id, event_id, time_ms, course
+		FROM (
+			SELECT swimmer_id, event_id, time_ms, course,
+				ROW_NUMBER() OVER (PARTITION BY swimmer_id, event_id ORDER BY course = ? DESC, time_ms, recorded_at, id) AS seed_rank
+			FROM swim_times
+			WHERE swimmer_id IN (`+placeholders(len(swimmerIDs))+`)
+				AND event_id IN (SELECT event_id FROM meet_events WHERE meet_id = ?)
+				AND status = 'ok' AND start_type = 'flat' AND time_ms > 0
+				AND date(recorded_at) < ? AND (? = '' OR date(recorded_at) >= ?)
+		)
+		WHERE seed_rank = 1`, args...)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var swimmerID, eventID, timeMs int
+		var seedCourse string
+		if err := rows.Scan(&swimmerID, &eventID, &timeMs, &seedCourse); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		index, ok := eventIDs[eventID]
+		if !ok {
+			continue // Relay events
+		}
+		entry := program[index]
+		entry.Swimmer = *swimmers[swimmerID]
+		entry.SeedMs = timeMs
+		entry.SeedCourse = seedCourse
+		seeds[index] = append(seeds[index], entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	entries := &models.MeetEntries{Meet: *meet, Course: course, TeamCode: teamCode, TeamName: teamName}
+	for _, eventSeeds := range seeds {
+		sort.Slice(eventSeeds, func(i, j int) bool {
+			return eventSeeds[i].Swimmer.Name < eventSeeds[j].Swimmer.Name
+		})
+		entries.Entries = append(entries.Entries, eventSeeds...)
+	}
+	if len(entries.Entries) == 0 {
+		return nil, http.StatusBadRequest, errors.New("None of the swimmers has a seed time in the meet's events")
+	}
+
+	return entries, http.StatusOK, nil
+}
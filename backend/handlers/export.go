@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"laplogger/models"
+	"laplogger/xlsx"
+)
+
+type ExportHandler struct {
+	db *sql.DB
+}
+
+func NewExportHandler(db *sql.DB) *ExportHandler {
+	return &ExportHandler{db: db}
+}
+
+// Export formats
+const (
+	exportCSV  = "csv"
+	exportJSON = "json"
+	exportXLSX = "xlsx"
+)
+
+// Columns of the exports, in the order they are written. Columns are only
+// ever added to the end, so spreadsheets reading an export keep working.
+var (
+	timeExportColumns = []string{
+		"time_id", "swimmer_id", "swimmer", "gender", "age", "age_group",
+		"event_id", "event", "distance", "units", "stroke", "course",
+		"time_ms", "time", "status", "dq_code", "start_type",
+		"meet_id", "meet", "date", "notes",
+	}
+	swimmerExportColumns = []string{
+		"swimmer_id", "name", "email", "date_of_birth", "age", "age_group",
+		"gender", "club", "uss_id", "created_at", "archived_at",
+	}
+)
+
+// ExportTimes writes the caller's times as CSV, JSON or an Excel workbook,
+// chosen with ?format= (csv by default), newest first. Times can be limited
+// with ?swimmer_id=, ?event_id=, ?meet_id=, ?course=, the dates ?from= and
+// ?to= (inclusive), and the swimmer's gender and age at the time with
+// ?gender=, ?age_group=, ?min_age= and ?max_age=. Times are written in the
+// caller's time format and rows are sent as they are read.
+func (h *ExportHandler) ExportTimes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseDemographicFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeFmt, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	swimmerID, ok := exportID(w, r, "swimmer_id", "Invalid swimmer ID")
+	if !ok {
+		return
+	}
+	eventID, ok := exportID(w, r, "event_id", "Invalid event ID")
+	if !ok {
+		return
+	}
+	meetID, ok := exportID(w, r, "meet_id", "Invalid meet ID")
+	if !ok {
+		return
+	}
+	from, ok := exportDate(w, r, "from", "From must be an ISO date (YYYY-MM-DD)")
+	if !ok {
+		return
+	}
+	to, ok := exportDate(w, r, "to", "To must be an ISO date (YYYY-MM-DD)")
+	if !ok {
+		return
+	}
+
+	if swimmerID != 0 {
+		if err := checkSwimmerOwner(h.db, swimmerID, userID); err == sql.ErrNoRows {
+			http.Error(w, "Swimmer not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if meetID != 0 {
+		if err := checkMeetOwner(h.db, meetID, userID); err == sql.ErrNoRows {
+			http.Error(w, "Meet not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rows, err := h.db.Query("SELECT "+timeDetailsColumns+" FROM swim_times st "+timeDetailsJoins+`
+		WHERE s.user_id = ?
+			AND (? = 0 OR st.swimmer_id = ?)
+			AND (? = 0 OR st.event_id = ?)
+			AND (? = 0 OR st.meet_id = ?)
+			AND (? = '' OR st.course = ?)
+			AND (? = '' OR date(st.recorded_at) >= ?)
+			AND (? = '' OR date(st.recorded_at) <= ?)
+		ORDER BY st.recorded_at DESC, st.id DESC`,
+		userID, swimmerID, swimmerID, eventID, eventID, meetID, meetID, course, course, from, from, to, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	table, err := newExportTable(w, format, "times", "Times", timeExportColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var t *models.SwimTimeWithDetails
+		if t, err = scanTimeWithDetails(rows, timeFmt); err != nil {
+			break
+		}
+		if !filter.matches(t.SwimmerGender, t.SwimmerAge) {
+			continue
+		}
+		err = table.row([]interface{}{
+			t.ID, t.SwimmerID, t.SwimmerName, optional(t.SwimmerGender), optionalInt(t.SwimmerAge), optional(t.AgeGroup),
+			t.EventID, t.EventName, t.Distance, t.Units, t.StrokeName, t.Course,
+			t.TimeMs, optional(t.FormattedTime), t.Status, optional(t.DQCode), t.StartType,
+			optionalInt(t.MeetID), optionalString(t.MeetName), t.RecordedAt.Format(dateLayout), optional(t.Notes),
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	finishExport(table, "times", err)
+}
+
+// ExportSwimmers writes the caller's swimmers as CSV, JSON or an Excel
+// workbook, chosen with ?format= (csv by default), in name order. Swimmers
+// can be filtered as GET /api/swimmers filters them, and ages are as of
+// today, ?age_on= or the date of ?meet_id=.
+func (h *ExportHandler) ExportSwimmers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseDemographicFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, status, err := ageDate(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	club := strings.TrimSpace(r.URL.Query().Get("club"))
+	query := "SELECT " + swimmerColumns + " FROM swimmers WHERE user_id = ? AND (? = '' OR club = ? COLLATE NOCASE)"
+	if r.URL.Query().Get("include_archived") != "true" {
+		query += " AND archived_at IS NULL"
+	}
+	query += " ORDER BY name, id"
+
+	rows, err := h.db.Query(query, userID, club, club)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	table, err := newExportTable(w, format, "swimmers", "Swimmers", swimmerExportColumns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var s *models.Swimmer
+		if s, err = scanSwimmer(rows); err != nil {
+			break
+		}
+		s.SetAgeOn(date)
+		if !filter.matches(s.Gender, s.Age) {
+			continue
+		}
+
+		var dob, archived interface{}
+		if s.DateOfBirth != nil {
+			dob = s.DateOfBirth.Format(dateLayout)
+		}
+		if s.ArchivedAt != nil {
+			archived = s.ArchivedAt.Format(dateLayout)
+		}
+		err = table.row([]interface{}{
+			s.ID, s.Name, optional(s.Email), dob, optionalInt(s.Age), optional(s.AgeGroup),
+			optional(s.Gender), optional(s.Club), optional(s.USSID), s.CreatedAt.Format(dateLayout), archived,
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	finishExport(table, "swimmers", err)
+}
+
+// exportFormat reads ?format=, which defaults to CSV
+func exportFormat(r *http.Request) (string, error) {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "":
+		return exportCSV, nil
+	case exportCSV, exportJSON, exportXLSX:
+		return format, nil
+	}
+	return "", errors.New("Format must be csv, json or xlsx")
+}
+
+// exportID reads an optional ID filter, which is 0 when absent. It responds
+// with message and returns false when the ID is invalid.
+func exportID(w http.ResponseWriter, r *http.Request, param, message string) (int, bool) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		http.Error(w, message, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// exportDate reads an optional date filter as YYYY-MM-DD, which is "" when
+// absent. It responds with message and returns false when the date is invalid.
+func exportDate(w http.ResponseWriter, r *http.Request, param, message string) (string, bool) {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return "", true
+	}
+	date, err := parseDate(value)
+	if err != nil {
+		http.Error(w, message, http.StatusBadRequest)
+		return "", false
+	}
+	return date.Format(dateLayout), true
+}
+
+// exportTable streams the rows of an export in one of the export formats.
+// Once it is created the response has started, so a failure part way can
+// only cut the export short.
+type exportTable interface {
+	row(values []interface{}) error
+	close() error
+}
+
+// newExportTable starts the response of an export named filename, writing
+// its header in formats that have one. Writes are buffered, so when it
+// fails nothing has been sent and an error response can still be written.
+func newExportTable(w http.ResponseWriter, format, filename, sheet string, columns []string) (exportTable, error) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	table, err := startExportTable(w, format, sheet, columns)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		return nil, err
+	}
+	return table, nil
+}
+
+// startExportTable sets the content type of an export and writes its header
+func startExportTable(w http.ResponseWriter, format, sheet string, columns []string) (exportTable, error) {
+	switch format {
+	case exportJSON:
+		w.Header().Set("Content-Type", "application/json")
+		return &jsonTable{w: w, columns: columns}, nil
+	case exportXLSX:
+		w.Header().Set("Content-Type", xlsx.ContentType)
+		sheetWriter, err := xlsx.NewWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxTable{sheetWriter}, sheetWriter.Write(stringValues(columns))
+	default:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		table := &csvTable{csv.NewWriter(w)}
+		return table, table.w.Write(columns)
+	}
+}
+
+// finishExport closes an export table, which ends the file even when an
+// error cut the export short. The response has started by then, so errors
+// can only be logged.
+func finishExport(table exportTable, name string, err error) {
+	if err != nil {
+		log.Printf("Export of %s cut short: %v", name, err)
+	}
+	if err := table.close(); err != nil {
+		log.Printf("Export of %s could not be finished: %v", name, err)
+	}
+}
+
+// csvTable writes an export as CSV with a header row
+type csvTable struct {
+	w *csv.Writer
+}
+
+func (t *csvTable) row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		if value != nil {
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTable) close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// jsonTable writes an export as a JSON array of objects with the columns as
+// keys, in column order
+type jsonTable struct {
+	w       io.Writer
+	columns []string
+	rows    int
+}
+
+func (t *jsonTable) row(values []interface{}) error {
+	var b strings.Builder
+	if t.rows == 0 {
+		b.WriteString("[\n")
+	} else {
+		b.WriteString(",\n")
+	}
+	t.rows++
+
+	b.WriteString("{")
+	for i, column := range t.columns {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+func (t *jsonTable) close() error {
+	end := "\n]\n"
+	if t.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(t.w, end)
+	return err
+}
+
+// xlsxTable writes an export as a one-sheet workbook with a header row
+type xlsxTable struct {
+	w *xlsx.Writer
+}
+
+func (t *xlsxTable) row(values []interface{}) error {
+	return t.w.Write(values)
+}
+
+func (t *xlsxTable) close() error {
+	return t.w.Close()
+}
+
+func stringValues(values []string) []interface{} {
+	row := make([]interface{}, len(values))
+	for i, value := range values {
+		row[i] = value
+	}
+	return row
+}
+
+// optional returns nil for blank text, so exports leave the cell empty
+func optional(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func optionalInt(value *int) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func optionalString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return optional(*value)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// uploadedFile returns the file sent with an import request: the "file"
+// field of a multipart form, or otherwise the raw request body
+func uploadedFile(r *http.Request) (io.ReadCloser, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	return r.Body, nil
+}
+
+// isDryRun reports whether an import request asked to only validate its file
+func isDryRun(r *http.Request) bool {
+	switch strings.ToLower(r.URL.Query().Get("dry_run")) {
+	case "true", "1", "yes":
+		return true
+	}
+	return false
+}
+
+// eventKey identifies an event by its total distance, units, stroke name
+// and number of legs
+type eventKey struct {
+	distance int
+	units    string
+	stroke   string
+	legs     int
+}
+
+// eventsByKey maps every event to its ID
+func eventsByKey(db *sql.DB) (map[eventKey]int, error) {
+	rows, err := db.Query(`
+		SELECT e.id, e.distance, e.units, s.name, e.legs
+		FROM events e
+		JOIN strokes s ON e.stroke_id = s.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make(map[eventKey]int)
+	for rows.Next() {
+		var id int
+		var key eventKey
+		if err := rows.Scan(&id, &key.distance, &key.units, &key.stroke, &key.legs); err != nil {
+			return nil, err
+		}
+		events[key] = id
+	}
+
+	return events, rows.Err()
+}
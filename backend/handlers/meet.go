@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+// dateLayout is the format meet dates and birth dates are stored in
+const dateLayout = "2006-01-02"
+
+type MeetHandler struct {
+	db *sql.DB
+}
+
+func NewMeetHandler(db *sql.DB) *MeetHandler {
+	return &MeetHandler{db: db}
+}
+
+func (h *MeetHandler) GetMeets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT id, name, location, meet_date, COALESCE(description, ''), created_at
+		FROM meets
+		WHERE user_id = ?
+		ORDER BY meet_date DESC, name`, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var meets []models.Meet
+	for rows.Next() {
+		var meet models.Meet
+		err := rows.Scan(&meet.ID, &meet.Name, &meet.Location, &meet.MeetDate, &meet.Description, &meet.CreatedAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		meets = append(meets, meet)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meets)
+}
+
+func (h *MeetHandler) GetMeet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	meet, err := getMeet(h.db, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meet)
+}
+
+func (h *MeetHandler) CreateMeet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateMeetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meetDate, err := validateMeetRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(
+		"INSERT INTO meets (name, location, meet_date, description, user_id) VALUES (?, ?, ?, ?, ?)",
+		req.Name, req.Location, meetDate.Format(dateLayout), req.Description, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return the created meet
+	meet, err := getMeet(h.db, int(id), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(meet)
+}
+
+func (h *MeetHandler) UpdateMeet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateMeetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meetDate, err := validateMeetRequest(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(
+		"UPDATE meets SET name = ?, location = ?, meet_date = ?, description = ? WHERE id = ? AND user_id = ?",
+		req.Name, req.Location, meetDate.Format(dateLayout), req.Description, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	}
+
+	meet, err := getMeet(h.db, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meet)
+}
+
+// DeleteMeet removes a meet and its scheduled events. Times and relays
+// recorded at the meet are kept and become practice swims.
+func (h *MeetHandler) DeleteMeet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM meets WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM meet_events WHERE meet_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE swim_times SET meet_id = NULL WHERE meet_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE relay_times SET meet_id = NULL WHERE meet_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getMeet returns sql.ErrNoRows unless the meet exists and belongs to the user
+func getMeet(db *sql.DB, meetID, userID int) (*models.Meet, error) {
+	var meet models.Meet
+	err := db.QueryRow(`
+		SELECT id, name, location, meet_date, COALESCE(description, ''), created_at
+		FROM meets WHERE id = ? AND user_id = ?`, meetID, userID).
+		Scan(&meet.ID, &meet.Name, &meet.Location, &meet.MeetDate, &meet.Description, &meet.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &meet, nil
+}
+
+// checkMeetOwner returns sql.ErrNoRows unless the meet exists and belongs to the user
+func checkMeetOwner(db *sql.DB, meetID, userID int) error {
+	var id int
+	return db.QueryRow("SELECT id FROM meets WHERE id = ? AND user_id = ?", meetID, userID).Scan(&id)
+}
+
+// validateMeetRequest checks the required meet fields and returns the parsed meet date
+func validateMeetRequest(req *models.CreateMeetRequest) (time.Time, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Location = strings.TrimSpace(req.Location)
+
+	if req.Name == "" {
+		return time.Time{}, errors.New("Name is required")
+	}
+	if req.Location == "" {
+		return time.Time{}, errors.New("Location is required")
+	}
+	if req.MeetDate == "" {
+		return time.Time{}, errors.New("Meet date is required")
+	}
+
+	meetDate, err := parseDate(req.MeetDate)
+	if err != nil {
+		return time.Time{}, errors.New("Meet date must be an ISO date (YYYY-MM-DD)")
+	}
+
+	return meetDate, nil
+}
+
+// parseDate accepts either a plain ISO date or a full RFC 3339 timestamp
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
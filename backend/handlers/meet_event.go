@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mattn/go-sqlite3"
+	"laplogger/models"
+)
+
+// sessionOrder sorts the common session names chronologically; any other
+// session name sorts after them alphabetically
+const sessionOrder = `
+	CASE me.session
+		WHEN 'morning' THEN 1
+		WHEN 'prelims' THEN 2
+		WHEN 'afternoon' THEN 3
+		WHEN 'evening' THEN 4
+		WHEN 'finals' THEN 5
+		ELSE 6
+	END`
+
+type MeetEventHandler struct {
+	db *sql.DB
+}
+
+func NewMeetEventHandler(db *sql.DB) *MeetEventHandler {
+	return &MeetEventHandler{db: db}
+}
+
+// GetMeetProgram returns the ordered program for a meet, optionally limited
+// to a single session with ?session=
+func (h *MeetEventHandler) GetMeetProgram(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkMeetOwner(h.db, meetID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session := normalizeSession(r.URL.Query().Get("session"))
+	program, err := h.getMeetProgram(meetID, session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(program)
+}
+
+// CreateMeetEvent schedules an event in a meet session. When no event number
+// is given the event is appended to the end of the session.
+func (h *MeetEventHandler) CreateMeetEvent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateMeetEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.MeetID = meetID
+	req.Session = normalizeSession(req.Session)
+
+	if req.EventID <= 0 || req.Session == "" {
+		http.Error(w, "Event ID and session are required", http.StatusBadRequest)
+		return
+	}
+	if req.EventNum < 0 {
+		http.Error(w, "Event number must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkMeetOwner(h.db, meetID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var eventID int
+	err = h.db.QueryRow("SELECT id FROM events WHERE id = ?", req.EventID).Scan(&eventID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Event not found", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.EventNum == 0 {
+		err := h.db.QueryRow(
+			"SELECT COALESCE(MAX(event_num), 0) + 1 FROM meet_events WHERE meet_id = ? AND session = ?",
+			meetID, req.Session).Scan(&req.EventNum)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := h.db.Exec(
+		"INSERT INTO meet_events (meet_id, event_id, session, event_num) VALUES (?, ?, ?, ?)",
+		req.MeetID, req.EventID, req.Session, req.EventNum)
+	if isUniqueViolation(err) {
+		http.Error(w, "Event is already scheduled in this session", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	meetEvent, err := h.getMeetEventWithDetails(int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(meetEvent)
+}
+
+// ReorderMeetEvents renumbers every event in a session according to the order
+// of the supplied meet event IDs, starting at 1
+func (h *MeetEventHandler) ReorderMeetEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReorderMeetEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Session = normalizeSession(req.Session)
+
+	if req.Session == "" || len(req.MeetEventIDs) == 0 {
+		http.Error(w, "Session and meet event IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkMeetOwner(h.db, meetID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// The new order must be a complete permutation of the session's events
+	rows, err := tx.Query("SELECT id FROM meet_events WHERE meet_id = ? AND session = ?", meetID, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	existing := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(existing) != len(req.MeetEventIDs) {
+		http.Error(w, "Meet event IDs must list every event in the session exactly once", http.StatusBadRequest)
+		return
+	}
+	seen := make(map[int]bool)
+	for _, id := range req.MeetEventIDs {
+		if !existing[id] || seen[id] {
+			http.Error(w, "Meet event IDs must list every event in the session exactly once", http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+
+	for i, id := range req.MeetEventIDs {
+		if _, err := tx.Exec("UPDATE meet_events SET event_num = ? WHERE id = ?", i+1, id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	program, err := h.getMeetProgram(meetID, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(program)
+}
+
+func (h *MeetEventHandler) DeleteMeetEvent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+	meetEventID, err := strconv.Atoi(vars["meet_event_id"])
+	if err != nil {
+		http.Error(w, "Invalid meet event ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkMeetOwner(h.db, meetID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM meet_events WHERE id = ? AND meet_id = ?", meetEventID, meetID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Meet event not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const meetEventDetailsQuery = `
+	SELECT
+		me.id, me.meet_id, me.event_id, me.session, me.event_num, me.created_at,
+		m.name as meet_name,
+		m.meet_date,
+		e.name as event_name,
+		s.name as stroke_name,
+		e.distance,
+		e.units
+	FROM meet_events me
+	JOIN meets m ON me.meet_id = m.id
+	JOIN events e ON me.event_id = e.id
+	JOIN strokes s ON e.stroke_id = s.id
+`
+
+// Helper function to get a single meet event with details
+func (h *MeetEventHandler) getMeetEventWithDetails(meetEventID int) (*models.MeetEventWithDetails, error) {
+	var me models.MeetEventWithDetails
+	err := h.db.QueryRow(meetEventDetailsQuery+" WHERE me.id = ?", meetEventID).Scan(
+		&me.ID, &me.MeetID, &me.EventID, &me.Session, &me.EventNum, &me.CreatedAt,
+		&me.MeetName, &me.MeetDate, &me.EventName, &me.StrokeName, &me.Distance, &me.Units,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &me, nil
+}
+
+// Helper function to get a meet's program, optionally for a single session
+func (h *MeetEventHandler) getMeetProgram(meetID int, session string) ([]models.MeetEventWithDetails, error) {
+	query := meetEventDetailsQuery + " WHERE me.meet_id = ?"
+	args := []interface{}{meetID}
+	if session != "" {
+		query += " AND me.session = ?"
+		args = append(args, session)
+	}
+	query += " ORDER BY " + sessionOrder + ", me.session, me.event_num"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var program []models.MeetEventWithDetails
+	for rows.Next() {
+		var me models.MeetEventWithDetails
+		err := rows.Scan(
+			&me.ID, &me.MeetID, &me.EventID, &me.Session, &me.EventNum, &me.CreatedAt,
+			&me.MeetName, &me.MeetDate, &me.EventName, &me.StrokeName, &me.Distance, &me.Units,
+		)
+		if err != nil {
+			return nil, err
+		}
+		program = append(program, me)
+	}
+
+	return program, rows.Err()
+}
+
+// normalizeSession lower-cases session names so "Finals" and "finals" are the same session
+func normalizeSession(session string) string {
+	return strings.ToLower(strings.TrimSpace(session))
+}
+
+// isUniqueViolation reports whether err is a SQLite UNIQUE constraint failure
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
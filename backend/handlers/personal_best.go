@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+// Values for the ?source= filter on personal bests
+const (
+	timeSourceMeet     = "meet"
+	timeSourcePractice = "practice"
+)
+
+// GetPersonalBests returns a swimmer's fastest valid flat-start time in each
+// event and course. With ?source=meet only meet times are considered, with ?source=practice
+// only practice times. ?course= limits the results to one course.
+func (h *TimeHandler) GetPersonalBests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	swimmerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+		return
+	}
+
+	source := r.URL.Query().Get("source")
+	if source != "" && source != timeSourceMeet && source != timeSourcePractice {
+		http.Error(w, "Source must be meet or practice", http.StatusBadRequest)
+		return
+	}
+
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if err := checkSwimmerOwner(h.db, swimmerID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Swimmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bests, err := h.getPersonalBests(swimmerID, source, course, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bests)
+}
+
+// Helper function to get the fastest time per event and course for a
+// swimmer. Ties go to the earliest swim.
+func (h *TimeHandler) getPersonalBests(swimmerID int, source, course string, format models.TimeFormat) ([]models.SwimTimeWithDetails, error) {
+	filter := ""
+	switch source {
+	case timeSourceMeet:
+		filter = " AND meet_id IS NOT NULL"
+	case timeSourcePractice:
+		filter = " AND meet_id IS NULL"
+	}
+
+	query := "SELECT " + timeDetailsColumns + `
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY event_id, course ORDER BY time_ms, recorded_at, id) AS pb_rank
+			FROM swim_times
+			WHERE swimmer_id = ? AND status = 'ok' AND start_type = 'flat' AND (? = '' OR course = ?)` + filter + `
+		) st
+		` + timeDetailsJoins + `
+		WHERE st.pb_rank = 1
+		ORDER BY str.id, e.units, e.distance, st.course`
+
+	return queryTimesWithDetails(h.db, format, query, swimmerID, course, course)
+}
+
+// getPreviousBest returns the swimmer's fastest valid flat-start time in an
+// event and course, which is invalid when they have never swum it
+func getPreviousBest(tx *sql.Tx, swimmerID, eventID int, course string) (sql.NullInt64, error) {
+	var best sql.NullInt64
+	err := tx.QueryRow("SELECT MIN(time_ms) FROM swim_times WHERE swimmer_id = ? AND event_id = ? AND course = ? AND status = 'ok' AND start_type = 'flat'",
+		swimmerID, eventID, course).Scan(&best)
+	return best, err
+}
+
+// applyPersonalBest fills in the PB fields of a newly created time. A
+// swimmer's first time in an event is always a personal best; a time equal
+// to the previous best is not.
+func applyPersonalBest(response *models.CreateTimeResponse, previousBest sql.NullInt64) {
+	if !previousBest.Valid {
+		response.IsPersonalBest = true
+		return
+	}
+
+	previous := int(previousBest.Int64)
+	response.PreviousBestMs = &previous
+
+	if response.TimeMs < previous {
+		improvement := previous - response.TimeMs
+		response.IsPersonalBest = true
+		response.ImprovementMs = &improvement
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"laplogger/models"
+)
+
+type PreferenceHandler struct {
+	db *sql.DB
+}
+
+func NewPreferenceHandler(db *sql.DB) *PreferenceHandler {
+	return &PreferenceHandler{db: db}
+}
+
+// GetPreferences returns the caller's time format preferences. Unset
+// preferences are returned empty.
+func (h *PreferenceHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := userTimeFormat(h.db, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// UpdatePreferences replaces the caller's time format preferences. An empty
+// format or a precision of 0 goes back to the default.
+func (h *PreferenceHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TimeFormat
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	style, ok := models.ParseTimeStyle(req.Style)
+	if !ok {
+		http.Error(w, "Time format must be clock or swim", http.StatusBadRequest)
+		return
+	}
+	req.Style = style
+	if req.Precision != 0 && req.Precision != models.PrecisionHundredths && req.Precision != models.PrecisionThousandths {
+		http.Error(w, "Time precision must be 2 (hundredths) or 3 (thousandths)", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.db.Exec("UPDATE users SET time_format = ?, time_precision = ? WHERE id = ?", req.Style, req.Precision, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
+
+// userTimeFormat returns the time format a user has chosen, with unset fields empty
+func userTimeFormat(db *sql.DB, userID int) (models.TimeFormat, error) {
+	var format models.TimeFormat
+	err := db.QueryRow("SELECT time_format, time_precision FROM users WHERE id = ?", userID).Scan(&format.Style, &format.Precision)
+	if err == sql.ErrNoRows {
+		return models.TimeFormat{}, nil
+	}
+	return format, err
+}
+
+// timeFormat returns the format to write times in for a request: the
+// ?time_format= and ?time_precision= parameters, then the user's
+// preferences, then the default. On failure it returns the HTTP status to
+// respond with.
+func timeFormat(db *sql.DB, r *http.Request, userID int) (models.TimeFormat, int, error) {
+	query := r.URL.Query()
+
+	style, ok := models.ParseTimeStyle(query.Get("time_format"))
+	if !ok {
+		return models.TimeFormat{}, http.StatusBadRequest, errors.New("Time format must be clock or swim")
+	}
+	precision, ok := models.ParsePrecision(query.Get("time_precision"))
+	if !ok {
+		return models.TimeFormat{}, http.StatusBadRequest, errors.New("Time precision must be 2 (hundredths) or 3 (thousandths)")
+	}
+
+	prefs, err := userTimeFormat(db, userID)
+	if err != nil {
+		return models.TimeFormat{}, http.StatusInternalServerError, err
+	}
+
+	format := models.TimeFormat{Style: style, Precision: precision}
+	return format.Merge(prefs).Merge(models.DefaultTimeFormat), 0, nil
+}
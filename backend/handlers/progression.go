@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+// progressionWindows are the rolling windows supported by ?window=
+var progressionWindows = map[string]time.Duration{
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"season": 120 * 24 * time.Hour,
+}
+
+const defaultProgressionWindow = "month"
+
+// GetProgression returns a swimmer's times in one event in chronological
+// order, each with the running best, the rolling average over the window and
+// the percent improvement of the best time over the window. Meters events
+// should be limited to one course with ?course= so SCM and LCM times are not
+// mixed.
+func (h *TimeHandler) GetProgression(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	swimmerID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+		return
+	}
+
+	eventID, err := strconv.Atoi(r.URL.Query().Get("event_id"))
+	if err != nil || eventID <= 0 {
+		http.Error(w, "Event ID is required", http.StatusBadRequest)
+		return
+	}
+
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultProgressionWindow
+	}
+	windowLength, ok := progressionWindows[window]
+	if !ok {
+		http.Error(w, "Window must be week, month or season", http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if err := checkSwimmerOwner(h.db, swimmerID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Swimmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + `
+		WHERE st.swimmer_id = ? AND st.event_id = ? AND st.status = 'ok' AND st.start_type = 'flat' AND (? = '' OR st.course = ?)
+		ORDER BY st.recorded_at, st.id`
+	times, err := queryTimesWithDetails(h.db, format, query, swimmerID, eventID, course, course)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ProgressionResponse{
+		SwimmerID: swimmerID,
+		EventID:   eventID,
+		Course:    course,
+		Window:    window,
+		Points:    buildProgression(times, windowLength),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// buildProgression computes the aggregates for each time, which must be in
+// chronological order. The rolling average covers every time recorded within
+// the window up to and including the current one. The improvement compares
+// the current best with the best as it stood when the window began (or the
+// first time in the window when there is no earlier time).
+func buildProgression(times []models.SwimTimeWithDetails, window time.Duration) []models.ProgressionPoint {
+	points := make([]models.ProgressionPoint, 0, len(times))
+
+	runningBest := 0
+	// bestBefore[i] is the running best before times[i] was swum
+	bestBefore := make([]int, len(times))
+	start, windowSum := 0, 0
+
+	for i, t := range times {
+		bestBefore[i] = runningBest
+		if runningBest == 0 || t.TimeMs < runningBest {
+			runningBest = t.TimeMs
+		}
+
+		// Slide the start of the window forward
+		windowSum += t.TimeMs
+		for t.RecordedAt.Sub(times[start].RecordedAt) > window {
+			windowSum -= times[start].TimeMs
+			start++
+		}
+
+		baseline := bestBefore[start]
+		if baseline == 0 {
+			baseline = times[start].TimeMs
+		}
+
+		points = append(points, models.ProgressionPoint{
+			SwimTimeWithDetails: t,
+			RunningBestMs:       runningBest,
+			RollingAverageMs:    windowSum / (i - start + 1),
+			ImprovementPct:      math.Round(float64(baseline-runningBest)/float64(baseline)*10000) / 100,
+		})
+	}
+
+	return points
+}
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+type RelayHandler struct {
+	db *sql.DB
+}
+
+func NewRelayHandler(db *sql.DB) *RelayHandler {
+	return &RelayHandler{db: db}
+}
+
+// GetRelays lists the caller's relay times, optionally filtered with
+// ?event_id=, ?meet_id=, ?swimmer_id= (relays the swimmer swam a leg of)
+// and ?course=
+func (h *RelayHandler) GetRelays(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filters := []struct {
+		param  string
+		label  string
+		clause string
+	}{
+		{"event_id", "event ID", "rt.event_id = ?"},
+		{"meet_id", "meet ID", "rt.meet_id = ?"},
+		{"swimmer_id", "swimmer ID", "rt.id IN (SELECT relay_time_id FROM relay_legs WHERE swimmer_id = ?)"},
+	}
+
+	query := "SELECT " + relayDetailsColumns + " FROM relay_times rt " + relayDetailsJoins + `
+		WHERE rt.user_id = ? AND (? = '' OR rt.course = ?)`
+	args := []interface{}{userID, course, course}
+	for _, f := range filters {
+		value := r.URL.Query().Get(f.param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid "+f.label, http.StatusBadRequest)
+			return
+		}
+		query += " AND " + f.clause
+		args = append(args, id)
+	}
+	query += " ORDER BY rt.recorded_at DESC"
+
+	relays, err := queryRelaysWithDetails(h.db, format, query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(relays)
+}
+
+func (h *RelayHandler) GetRelay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid relay ID", http.StatusBadRequest)
+		return
+	}
+
+	relay, err := h.getRelayWithDetails(id, userID, format)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Relay not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(relay)
+}
+
+// CreateRelay records a relay swim with its legs in swimming order
+func (h *RelayHandler) CreateRelay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var req models.CreateRelayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status, err := validateRelayRequest(h.db, &req, userID); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO relay_times (user_id, event_id, meet_id, team_name, time_ms, course, notes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		userID, req.EventID, req.MeetID, req.TeamName, req.TimeMs, req.Course, req.Notes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := saveRelayLegs(tx, int(id), req.Legs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	relay, err := h.getRelayWithDetails(int(id), userID, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(relay)
+}
+
+// UpdateRelay replaces a relay swim and its legs
+func (h *RelayHandler) UpdateRelay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid relay ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateRelayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status, err := validateRelayRequest(h.db, &req, userID); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE relay_times SET event_id = ?, meet_id = ?, team_name = ?, time_ms = ?, course = ?, notes = ?
+		WHERE id = ? AND user_id = ?`,
+		req.EventID, req.MeetID, req.TeamName, req.TimeMs, req.Course, req.Notes, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Relay not found", http.StatusNotFound)
+		return
+	}
+
+	if err := saveRelayLegs(tx, id, req.Legs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	relay, err := h.getRelayWithDetails(id, userID, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(relay)
+}
+
+func (h *RelayHandler) DeleteRelay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid relay ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM relay_times WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Relay not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM relay_legs WHERE relay_time_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateRelayRequest checks a relay against its event: one leg per relay
+// leg of the event, each swum by a different swimmer belonging to the user,
+// and leg splits either all missing or adding up to the relay time. On
+// failure it returns the HTTP status to respond with.
+func validateRelayRequest(db *sql.DB, req *models.CreateRelayRequest, userID int) (int, error) {
+	req.TeamName = strings.TrimSpace(req.TeamName)
+
+	var err error
+	if req.TimeMs, err = models.ResolveTime(req.TimeMs, req.Time); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.EventID <= 0 || req.TimeMs <= 0 {
+		return http.StatusBadRequest, errors.New("Event ID and Time are required")
+	}
+
+	var units string
+	var legs int
+	err = db.QueryRow("SELECT units, legs FROM events WHERE id = ?", req.EventID).Scan(&units, &legs)
+	if err == sql.ErrNoRows {
+		return http.StatusBadRequest, errors.New("Event not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if legs <= 1 {
+		return http.StatusBadRequest, errors.New("Event is not a relay")
+	}
+
+	if req.Course, err = eventCourse(req.Course, units); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if len(req.Legs) != legs {
+		return http.StatusBadRequest, fmt.Errorf("Relay must have %d legs", legs)
+	}
+
+	seen := make(map[int]bool)
+	withSplits, total := 0, 0
+	for _, leg := range req.Legs {
+		if leg.SwimmerID <= 0 {
+			return http.StatusBadRequest, errors.New("Every leg needs a swimmer ID")
+		}
+		if seen[leg.SwimmerID] {
+			return http.StatusBadRequest, errors.New("A swimmer can only swim one leg of a relay")
+		}
+		seen[leg.SwimmerID] = true
+
+		if leg.SplitMs != nil {
+			if *leg.SplitMs <= 0 {
+				return http.StatusBadRequest, errors.New("Leg splits must be positive")
+			}
+			withSplits++
+			total += *leg.SplitMs
+		}
+	}
+	if withSplits > 0 && withSplits < len(req.Legs) {
+		return http.StatusBadRequest, errors.New("Give a split for every leg or for none")
+	}
+	if withSplits > 0 && total != req.TimeMs {
+		return http.StatusBadRequest, fmt.Errorf("Leg splits add up to %d ms but the relay time is %d ms", total, req.TimeMs)
+	}
+
+	// The swimmers and meet must belong to the caller
+	for _, leg := range req.Legs {
+		if err := checkSwimmerOwner(db, leg.SwimmerID, userID); err == sql.ErrNoRows {
+			return http.StatusNotFound, errors.New("Swimmer not found")
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if req.MeetID != nil {
+		if err := checkMeetOwner(db, *req.MeetID, userID); err == sql.ErrNoRows {
+			return http.StatusNotFound, errors.New("Meet not found")
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return 0, nil
+}
+
+// saveRelayLegs replaces a relay's legs, numbering them in the order given
+func saveRelayLegs(tx *sql.Tx, relayID int, legs []models.RelayLegInput) error {
+	if _, err := tx.Exec("DELETE FROM relay_legs WHERE relay_time_id = ?", relayID); err != nil {
+		return err
+	}
+
+	for i, leg := range legs {
+		_, err := tx.Exec(
+			"INSERT INTO relay_legs (relay_time_id, leg_num, swimmer_id, split_ms) VALUES (?, ?, ?, ?)",
+			relayID, i+1, leg.SwimmerID, leg.SplitMs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// relayDetailsColumns are the columns read by queryRelaysWithDetails, in
+// order. They expect the relay to be aliased rt and joined with relayDetailsJoins.
+const relayDetailsColumns = `
+	rt.id, rt.event_id, rt.meet_id, COALESCE(rt.team_name, ''), rt.time_ms, rt.course, rt.round, COALESCE(rt.notes, ''), rt.recorded_at,
+	e.name as event_name,
+	str.name as stroke_name,
+	e.distance,
+	e.units,
+	m.name as meet_name
+`
+
+const relayDetailsJoins = `
+	JOIN events e ON rt.event_id = e.id
+	JOIN strokes str ON e.stroke_id = str.id
+	LEFT JOIN meets m ON rt.meet_id = m.id
+`
+
+// queryRelaysWithDetails runs a query selecting relayDetailsColumns and
+// reads every row along with its legs, writing times in the given format
+func queryRelaysWithDetails(db *sql.DB, format models.TimeFormat, query string, args ...interface{}) ([]models.RelayTimeWithDetails, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relays := []models.RelayTimeWithDetails{}
+	for rows.Next() {
+		var relay models.RelayTimeWithDetails
+		var meetName sql.NullString
+		err := rows.Scan(
+			&relay.ID, &relay.EventID, &relay.MeetID, &relay.TeamName, &relay.TimeMs, &relay.Course, &relay.Round, &relay.Notes, &relay.RecordedAt,
+			&relay.EventName, &relay.StrokeName, &relay.Distance, &relay.Units, &meetName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if meetName.Valid {
+			relay.MeetName = &meetName.String
+		}
+		relay.FormattedTime = format.Format(relay.TimeMs)
+		relays = append(relays, relay)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range relays {
+		if relays[i].Legs, err = getRelayLegs(db, &relays[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return relays, nil
+}
+
+// getRelayLegs reads a relay's legs in swimming order
+func getRelayLegs(db *sql.DB, relay *models.RelayTimeWithDetails) ([]models.RelayLeg, error) {
+	rows, err := db.Query(`
+		SELECT rl.id, rl.relay_time_id, rl.leg_num, rl.swimmer_id, s.name, rl.split_ms
+		FROM relay_legs rl
+		JOIN swimmers s ON rl.swimmer_id = s.id
+		WHERE rl.relay_time_id = ?
+		ORDER BY rl.leg_num`, relay.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	legs := []models.RelayLeg{}
+	for rows.Next() {
+		var leg models.RelayLeg
+		if err := rows.Scan(&leg.ID, &leg.RelayTimeID, &leg.LegNum, &leg.SwimmerID, &leg.SwimmerName, &leg.SplitMs); err != nil {
+			return nil, err
+		}
+		leg.StrokeName = models.RelayLegStroke(relay.StrokeName, leg.LegNum)
+		leg.StartType = models.RelayLegStartType(leg.LegNum)
+		legs = append(legs, leg)
+	}
+
+	return legs, rows.Err()
+}
+
+// Helper function to get a single relay with details
+func (h *RelayHandler) getRelayWithDetails(relayID, userID int, format models.TimeFormat) (*models.RelayTimeWithDetails, error) {
+	query := "SELECT " + relayDetailsColumns + " FROM relay_times rt " + relayDetailsJoins + " WHERE rt.id = ? AND rt.user_id = ?"
+	relays, err := queryRelaysWithDetails(h.db, format, query, relayID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(relays) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &relays[0], nil
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"laplogger/lenex"
+	"laplogger/models"
+)
+
+// ExportLENEXResults writes the caller's program and results at a meet as a
+// LENEX file: zipped (.lxf) by default, or plain XML (.lef) with
+// ?format=lef. ?club= limits the results to one club's swimmers. The meet
+// is written in the course most of its results were swum in unless
+// ?course= names one.
+func (h *MeetEventHandler) ExportLENEXResults(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	meetID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid meet ID", http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "lxf"
+	}
+	if format != "lxf" && format != "lef" {
+		http.Error(w, "Format must be lxf or lef", http.StatusBadRequest)
+		return
+	}
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meet, err := getMeet(h.db, meetID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Meet not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results, err := h.meetResults(meet, userID, course)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if club := r.URL.Query().Get("club"); club != "" {
+		results = results.ClubResults(club)
+	}
+
+	var file bytes.Buffer
+	if format == "lef" {
+		err = lenex.WriteXML(&file, results)
+		w.Header().Set("Content-Type", "application/xml")
+	} else {
+		err = lenex.Write(&file, results)
+		w.Header().Set("Content-Type", "application/zip")
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="meet-%d-results.%s"`, meet.ID, format))
+	w.Write(file.Bytes())
+}
+
+// meetResults gathers the caller's program, swims and relays at a meet into
+// a results file. When course is empty the meet's course is the one most of
+// its results were swum in. Results are dated on the meet's date rather than
+// when they were recorded.
+func (h *MeetEventHandler) meetResults(meet *models.Meet, userID int, course string) (*models.ResultsFile, error) {
+	times, err := queryTimesWithDetails(h.db, models.DefaultTimeFormat,
+		"SELECT "+timeDetailsColumns+" FROM swim_times st "+timeDetailsJoins+`
+		WHERE st.meet_id = ? AND s.user_id = ? AND st.start_type = 'flat'
+		ORDER BY str.id, e.distance, st.recorded_at, st.time_ms, st.id`, meet.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	relays, err := queryRelaysWithDetails(h.db, models.DefaultTimeFormat,
+		"SELECT "+relayDetailsColumns+" FROM relay_times rt "+relayDetailsJoins+`
+		WHERE rt.meet_id = ? AND rt.user_id = ?
+		ORDER BY str.id, e.distance, rt.recorded_at, rt.time_ms, rt.id`, meet.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if course == "" {
+		counts := make(map[string]int)
+		for _, t := range times {
+			counts[t.Course]++
+		}
+		for _, relay := range relays {
+			counts[relay.Course]++
+		}
+		for _, c := range models.Courses {
+			if course == "" || counts[c] > counts[course] {
+				course = c
+			}
+		}
+		if counts[course] == 0 {
+			course = ""
+		}
+	}
+
+	results := &models.ResultsFile{
+		Meet: models.ImportedMeet{Name: meet.Name, Location: meet.Location, Date: meet.MeetDate, Course: course},
+	}
+
+	rows, err := h.db.Query(`
+		SELECT me.session, me.event_num, e.distance, e.units, s.name, e.legs
+		FROM meet_events me
+		JOIN events e ON me.event_id = e.id
+		JOIN strokes s ON e.stroke_id = s.id
+		WHERE me.meet_id = ?
+		ORDER BY `+sessionOrder+`, me.session, me.event_num`, meet.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var me models.ImportedMeetEvent
+		var units string
+		if err := rows.Scan(&me.Session, &me.EventNum, &me.Distance, &units, &me.Stroke, &me.Legs); err != nil {
+			return nil, err
+		}
+		me.Course = unitsCourse(units, results.Meet.Course)
+		if results.Meet.Course == "" {
+			results.Meet.Course = me.Course
+		}
+		results.Program = append(results.Program, me)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if results.Meet.Course == "" {
+		results.Meet.Course = models.DefaultCourse
+	}
+
+	swimmers := make(map[int]models.ImportedSwimmer)
+	swimmer := func(id int) (models.ImportedSwimmer, error) {
+		if s, ok := swimmers[id]; ok {
+			return s, nil
+		}
+		s, err := getSwimmer(h.db, id, userID)
+		if err != nil {
+			return models.ImportedSwimmer{}, err
+		}
+		swimmers[id] = models.ImportedSwimmer{
+			Name:        s.Name,
+			USSID:       s.USSID,
+			DateOfBirth: s.DateOfBirth,
+			Gender:      s.Gender,
+			Club:        s.Club,
+		}
+		return swimmers[id], nil
+	}
+
+	for _, t := range times {
+		swim := models.ImportedSwim{
+			Distance:  t.Distance,
+			Stroke:    t.StrokeName,
+			Course:    t.Course,
+			Round:     t.Round,
+			Date:      meet.MeetDate,
+			TimeMs:    t.TimeMs,
+			Status:    t.Status,
+			SplitType: models.SplitTypeCumulative,
+		}
+		if swim.Swimmer, err = swimmer(t.SwimmerID); err != nil {
+			return nil, err
+		}
+		for _, split := range t.Splits {
+			swim.Splits = append(swim.Splits, models.SplitInput{Distance: split.Distance, TimeMs: split.CumulativeMs})
+		}
+		results.Swims = append(results.Swims, swim)
+	}
+
+	for _, relay := range relays {
+		imported := models.ImportedRelay{
+			TeamName: relay.TeamName,
+			Distance: relay.Distance,
+			Stroke:   relay.StrokeName,
+			Course:   relay.Course,
+			Round:    relay.Round,
+			Date:     meet.MeetDate,
+			TimeMs:   relay.TimeMs,
+			Status:   models.ResultOK,
+		}
+		for _, leg := range relay.Legs {
+			s, err := swimmer(leg.SwimmerID)
+			if err != nil {
+				return nil, err
+			}
+			imported.Legs = append(imported.Legs, models.ImportedRelayLeg{Swimmer: s, SplitMs: leg.SplitMs})
+		}
+		results.Relays = append(results.Relays, imported)
+	}
+
+	return results, nil
+}
+
+// unitsCourse returns the course an event in the given units is swum in at
+// a meet swum in course
+func unitsCourse(units, course string) string {
+	if models.CourseUnits(course) == units && course != "" {
+		return course
+	}
+	if units == models.UnitsYards {
+		return models.CourseSCY
+	}
+	return models.DefaultCourse
+}
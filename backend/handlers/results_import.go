@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"laplogger/lenex"
+	"laplogger/models"
+	"laplogger/sdif"
+)
+
+type ImportHandler struct {
+	db *sql.DB
+}
+
+func NewImportHandler(db *sql.DB) *ImportHandler {
+	return &ImportHandler{db: db}
+}
+
+// ImportSDIF imports a meet's results from a USA Swimming SDIF (.sd3 or
+// .cl2) file, sent as the request body or as the "file" field of a
+// multipart form. With ?dry_run=true the file is matched and reported on
+// without saving anything.
+func (h *ImportHandler) ImportSDIF(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := uploadedFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	results, skipped, err := sdif.Parse(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.importResults(w, r, userID, results, skipped, "Imported from SDIF")
+}
+
+// ImportLENEX imports a meet's program and results from a LENEX file,
+// zipped (.lxf) or not (.lef), sent like an SDIF file. Every club's results
+// are imported. With ?dry_run=true nothing is saved.
+func (h *ImportHandler) ImportLENEX(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	file, err := uploadedFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	results, skipped, err := lenex.Parse(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.importResults(w, r, userID, results, skipped, "Imported from LENEX")
+}
+
+// importResults saves a parsed results file, or only reports on it for a dry
+// run, and writes the import report. Records the parser could not read are
+// passed in as skipped. ?club= limits the import to one club's results.
+func (h *ImportHandler) importResults(w http.ResponseWriter, r *http.Request, userID int, results *models.ResultsFile, skipped []models.ImportError, description string) {
+	if club := r.URL.Query().Get("club"); club != "" {
+		results = results.ClubResults(club)
+	}
+
+	events, err := eventsByKey(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	report := &models.ResultsImportResult{
+		DryRun:   isDryRun(r),
+		Swimmers: []models.SwimmerMatch{},
+		Skipped:  append([]models.ImportError{}, skipped...),
+		Warnings: []models.ImportError{},
+	}
+
+	if err := saveResults(tx, userID, results, events, description, report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if report.DryRun {
+		// IDs handed out inside the rolled back transaction mean nothing
+		if report.MeetCreated {
+			report.Meet.ID = 0
+		}
+		for i := range report.Swimmers {
+			if report.Swimmers[i].MatchedBy == matchCreated {
+				report.Swimmers[i].SwimmerID = 0
+			}
+		}
+	} else if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// saveResults matches the meet and swimmers of a results file and inserts
+// its times and relays in tx, filling in the report. Results that are
+// already recorded are counted as duplicates and not inserted again.
+func saveResults(tx *sql.Tx, userID int, results *models.ResultsFile, events map[eventKey]int, description string, report *models.ResultsImportResult) error {
+	meetID, created, err := matchMeet(tx, userID, results.Meet, description)
+	if err != nil {
+		return err
+	}
+	report.MeetCreated = created
+	report.Meet = models.Meet{
+		ID:          meetID,
+		Name:        results.Meet.Name,
+		Location:    results.Meet.Location,
+		MeetDate:    results.Meet.Date,
+		Description: description,
+	}
+
+	// Program events the meet already has are left as they are
+	for _, me := range results.Program {
+		key := eventKey{me.Distance, models.CourseUnits(me.Course), me.Stroke, me.Legs}
+		eventID, ok := events[key]
+		if !ok {
+			report.Skipped = append(report.Skipped, models.ImportError{
+				Line:    me.Line,
+				Message: fmt.Sprintf("No %d %s %s event with %d legs for event %d", me.Distance, key.units, me.Stroke, me.Legs, me.EventNum),
+			})
+			continue
+		}
+		result, err := tx.Exec("INSERT OR IGNORE INTO meet_events (meet_id, event_id, session, event_num) VALUES (?, ?, ?, ?)",
+			meetID, eventID, normalizeSession(me.Session), me.EventNum)
+		if err != nil {
+			return err
+		}
+		if added, err := result.RowsAffected(); err != nil {
+			return err
+		} else if added > 0 {
+			report.EventsAdded++
+		}
+	}
+
+	swimmers, err := newSwimmerMatcher(tx, userID, report)
+	if err != nil {
+		return err
+	}
+
+	for _, swim := range results.Swims {
+		skip := func(format string, args ...interface{}) {
+			report.Skipped = append(report.Skipped, models.ImportError{Line: swim.Line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		eventID, ok := events[eventKey{swim.Distance, models.CourseUnits(swim.Course), swim.Stroke, 1}]
+		if !ok {
+			skip("No %d %s %s event for %s", swim.Distance, models.CourseUnits(swim.Course), swim.Stroke, swim.Swimmer.Name)
+			continue
+		}
+
+		swimmerID, err := swimmers.match(swim.Swimmer)
+		if err != nil {
+			return err
+		}
+
+		var duplicate int
+		err = tx.QueryRow(`
+			SELECT COUNT(*) FROM swim_times
+			WHERE swimmer_id = ? AND event_id = ? AND meet_id = ? AND course = ? AND time_ms = ? AND status = ? AND round = ?`,
+			swimmerID, eventID, meetID, swim.Course, swim.TimeMs, swim.Status, swim.Round).Scan(&duplicate)
+		if err != nil {
+			return err
+		}
+		if duplicate > 0 {
+			report.Duplicates++
+			continue
+		}
+
+		var splits []models.Split
+		if len(swim.Splits) > 0 && swim.TimeMs > 0 {
+			if splits, err = models.BuildSplits(swim.SplitType, swim.Splits, swim.Distance, swim.TimeMs); err != nil {
+				report.Warnings = append(report.Warnings, models.ImportError{
+					Line:    swim.Line,
+					Message: fmt.Sprintf("Splits for %s left out: %s", swim.Swimmer.Name, err),
+				})
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO swim_times (swimmer_id, event_id, meet_id, time_ms, course, start_type, status, round, recorded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			swimmerID, eventID, meetID, swim.TimeMs, swim.Course, models.StartFlat, swim.Status, swim.Round, swim.Date)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if err := saveSplits(tx, int(id), splits); err != nil {
+			return err
+		}
+		created, err := getSwimTime(tx, int(id), userID)
+		if err != nil {
+			return err
+		}
+		if err := recordTimeAudit(tx, models.AuditActionCreate, userID, nil, created); err != nil {
+			return err
+		}
+		report.TimesImported++
+	}
+
+	for _, relay := range results.Relays {
+		skip := func(format string, args ...interface{}) {
+			report.Skipped = append(report.Skipped, models.ImportError{Line: relay.Line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if relay.Status != models.ResultOK {
+			skip("%s relay has no valid time (%s)", relay.TeamName, relay.Status)
+			continue
+		}
+		if len(relay.Legs) == 0 {
+			skip("%s relay lists no swimmers", relay.TeamName)
+			continue
+		}
+		key := eventKey{relay.Distance, models.CourseUnits(relay.Course), relay.Stroke, len(relay.Legs)}
+		eventID, ok := events[key]
+		if !ok {
+			skip("No %d %s %s relay event with %d legs for %s", relay.Distance, key.units, relay.Stroke, key.legs, relay.TeamName)
+			continue
+		}
+
+		var duplicate int
+		err := tx.QueryRow(`
+			SELECT COUNT(*) FROM relay_times
+			WHERE user_id = ? AND event_id = ? AND meet_id = ? AND team_name = ? AND course = ? AND round = ? AND time_ms = ?`,
+			userID, eventID, meetID, relay.TeamName, relay.Course, relay.Round, relay.TimeMs).Scan(&duplicate)
+		if err != nil {
+			return err
+		}
+		if duplicate > 0 {
+			report.Duplicates++
+			continue
+		}
+
+		// Leg splits are kept only when every leg has one and they add up
+		complete, splitTotal := true, 0
+		for _, leg := range relay.Legs {
+			if leg.SplitMs == nil {
+				complete = false
+				continue
+			}
+			splitTotal += *leg.SplitMs
+		}
+		keepSplits := complete && splitTotal == relay.TimeMs
+		if !keepSplits && splitTotal > 0 {
+			report.Warnings = append(report.Warnings, models.ImportError{
+				Line:    relay.Line,
+				Message: fmt.Sprintf("Leg splits for %s left out: they do not add up to the relay time", relay.TeamName),
+			})
+		}
+
+		legs := make([]models.RelayLegInput, len(relay.Legs))
+		for i, leg := range relay.Legs {
+			if legs[i].SwimmerID, err = swimmers.match(leg.Swimmer); err != nil {
+				return err
+			}
+			if keepSplits {
+				legs[i].SplitMs = leg.SplitMs
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO relay_times (user_id, event_id, meet_id, team_name, time_ms, course, round, recorded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			userID, eventID, meetID, relay.TeamName, relay.TimeMs, relay.Course, relay.Round, relay.Date)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		if err := saveRelayLegs(tx, int(id), legs); err != nil {
+			return err
+		}
+		report.RelaysImported++
+	}
+
+	return nil
+}
+
+// matchMeet finds the caller's meet with the same name and start date, or
+// creates it
+func matchMeet(tx *sql.Tx, userID int, meet models.ImportedMeet, description string) (int, bool, error) {
+	meet.Name = strings.TrimSpace(meet.Name)
+	date := meet.Date.Format(dateLayout)
+
+	var id int
+	err := tx.QueryRow("SELECT id FROM meets WHERE user_id = ? AND name = ? COLLATE NOCASE AND date(meet_date) = ?",
+		userID, meet.Name, date).Scan(&id)
+	if err == nil {
+		return id, false, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+
+	result, err := tx.Exec("INSERT INTO meets (name, location, meet_date, description, user_id) VALUES (?, ?, ?, ?, ?)",
+		meet.Name, meet.Location, date, description, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	newID, err := result.LastInsertId()
+	return int(newID), true, err
+}
+
+// Ways an imported swimmer is matched to one of the caller's swimmers
+const (
+	matchUSSID   = "uss_id"
+	matchNameDOB = "name_dob"
+	matchName    = "name"
+	matchCreated = "created"
+)
+
+// swimmerMatcher finds the caller's swimmers named in imported results,
+// creating any it cannot find
+type swimmerMatcher struct {
+	tx       *sql.Tx
+	userID   int
+	report   *models.ResultsImportResult
+	swimmers []knownSwimmer
+	matched  map[string]int // Swimmer IDs by imported swimmer
+	reported map[int]bool   // Swimmers already in the report
+}
+
+type knownSwimmer struct {
+	id    int
+	name  string // Normalized with matchingName
+	ussID string
+	dob   *time.Time
+}
+
+func newSwimmerMatcher(tx *sql.Tx, userID int, report *models.ResultsImportResult) (*swimmerMatcher, error) {
+	rows, err := tx.Query("SELECT id, name, COALESCE(uss_id, ''), date_of_birth FROM swimmers WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := &swimmerMatcher{tx: tx, userID: userID, report: report, matched: make(map[string]int), reported: make(map[int]bool)}
+	for rows.Next() {
+		var s knownSwimmer
+		var dob sql.NullTime
+		if err := rows.Scan(&s.id, &s.name, &s.ussID, &dob); err != nil {
+			return nil, err
+		}
+		s.name = matchingName(s.name)
+		s.ussID = strings.ToUpper(s.ussID)
+		if dob.Valid {
+			s.dob = &dob.Time
+		}
+		m.swimmers = append(m.swimmers, s)
+	}
+
+	return m, rows.Err()
+}
+
+// match returns the ID of the swimmer, matching by USA Swimming ID, then by
+// name and date of birth, then by name alone when exactly one swimmer has
+// the name and the dates of birth don't conflict. Unmatched swimmers are
+// created. Missing registration details of matched swimmers are filled in.
+func (m *swimmerMatcher) match(swimmer models.ImportedSwimmer) (int, error) {
+	name := matchingName(swimmer.Name)
+	key := swimmer.USSID + "|" + name
+	if swimmer.DateOfBirth != nil {
+		key += "|" + swimmer.DateOfBirth.Format(dateLayout)
+	}
+	if id, ok := m.matched[key]; ok {
+		return id, nil
+	}
+
+	id, matchedBy := m.find(swimmer, name)
+	if id != 0 {
+		_, err := m.tx.Exec(`
+			UPDATE swimmers SET uss_id = COALESCE(uss_id, ?), date_of_birth = COALESCE(date_of_birth, ?),
+				gender = COALESCE(gender, ?), club = COALESCE(club, ?)
+			WHERE id = ?`,
+			nullableString(swimmer.USSID), nullableDate(swimmer.DateOfBirth),
+			nullableString(swimmer.Gender), nullableString(swimmer.Club), id)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		result, err := m.tx.Exec(
+			"INSERT INTO swimmers (name, date_of_birth, gender, club, uss_id, user_id) VALUES (?, ?, ?, ?, ?, ?)",
+			swimmer.Name, nullableDate(swimmer.DateOfBirth), nullableString(swimmer.Gender),
+			nullableString(swimmer.Club), nullableString(swimmer.USSID), m.userID)
+		if err != nil {
+			return 0, err
+		}
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		id, matchedBy = int(newID), matchCreated
+		m.swimmers = append(m.swimmers, knownSwimmer{id: id, name: name, ussID: swimmer.USSID, dob: swimmer.DateOfBirth})
+	}
+
+	m.matched[key] = id
+	if m.reported[id] {
+		return id, nil
+	}
+	m.reported[id] = true
+	m.report.Swimmers = append(m.report.Swimmers, models.SwimmerMatch{
+		Name:      swimmer.Name,
+		USSID:     swimmer.USSID,
+		SwimmerID: id,
+		MatchedBy: matchedBy,
+	})
+	return id, nil
+}
+
+// find looks for an existing swimmer, returning 0 when there is none
+func (m *swimmerMatcher) find(swimmer models.ImportedSwimmer, name string) (int, string) {
+	if swimmer.USSID != "" {
+		for _, s := range m.swimmers {
+			if s.ussID == swimmer.USSID {
+				return s.id, matchUSSID
+			}
+		}
+	}
+
+	var sameName []knownSwimmer
+	for _, s := range m.swimmers {
+		if s.name != name {
+			continue
+		}
+		// A different registration ID or birthday is a different swimmer
+		if s.ussID != "" && swimmer.USSID != "" {
+			continue
+		}
+		if s.dob != nil && swimmer.DateOfBirth != nil {
+			if s.dob.Equal(*swimmer.DateOfBirth) {
+				return s.id, matchNameDOB
+			}
+			continue
+		}
+		sameName = append(sameName, s)
+	}
+
+	if len(sameName) == 1 {
+		return sameName[0].id, matchName
+	}
+	return 0, ""
+}
+
+// matchingName normalizes a name for comparison
+func matchingName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
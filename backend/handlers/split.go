@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+// GetSplits returns the splits recorded for a time
+func (h *TimeHandler) GetSplits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, _, err := getTimeAndDistance(h.db, id, userID); err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	times := []models.SwimTimeWithDetails{{SwimTime: models.SwimTime{ID: id}}}
+	if err := loadSplits(h.db, times); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	splits := times[0].Splits
+	if splits == nil {
+		splits = []models.Split{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(splits)
+}
+
+// SetSplits replaces the splits recorded for a time. The final split must
+// equal the time and finish at the event distance.
+func (h *TimeHandler) SetSplits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SetSplitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	timeMs, distance, err := getTimeAndDistance(h.db, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if timeMs == 0 {
+		http.Error(w, "Splits can only be recorded for a swim with a time", http.StatusBadRequest)
+		return
+	}
+
+	splits, err := models.BuildSplits(req.SplitType, req.Splits, distance, timeMs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := saveSplits(tx, id, splits); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	timeWithDetails, err := h.getTimeWithDetails(id, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(timeWithDetails)
+}
+
+// DeleteSplits removes every split recorded for a time
+func (h *TimeHandler) DeleteSplits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, _, err := getTimeAndDistance(h.db, id, userID); err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM swim_splits WHERE swim_time_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getTimeAndDistance returns a time's length in milliseconds and its event
+// distance, or sql.ErrNoRows unless the time belongs to the user
+func getTimeAndDistance(db *sql.DB, timeID, userID int) (int, int, error) {
+	var timeMs, distance int
+	err := db.QueryRow(`
+		SELECT st.time_ms, e.distance
+		FROM swim_times st
+		JOIN swimmers s ON st.swimmer_id = s.id
+		JOIN events e ON st.event_id = e.id
+		WHERE st.id = ? AND s.user_id = ?`, timeID, userID).Scan(&timeMs, &distance)
+	return timeMs, distance, err
+}
+
+// saveSplits replaces a time's splits
+func saveSplits(tx *sql.Tx, timeID int, splits []models.Split) error {
+	if _, err := tx.Exec("DELETE FROM swim_splits WHERE swim_time_id = ?", timeID); err != nil {
+		return err
+	}
+
+	for _, split := range splits {
+		_, err := tx.Exec(
+			"INSERT INTO swim_splits (swim_time_id, split_num, distance, time_ms) VALUES (?, ?, ?, ?)",
+			timeID, split.SplitNum, split.Distance, split.CumulativeMs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countSplits returns how many splits are recorded for a time
+func countSplits(tx *sql.Tx, timeID int) (int, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM swim_splits WHERE swim_time_id = ?", timeID).Scan(&count)
+	return count, err
+}
+
+// loadSplits attaches the recorded splits to each time
+func loadSplits(db *sql.DB, times []models.SwimTimeWithDetails) error {
+	index := make(map[int]*models.SwimTimeWithDetails, len(times))
+	for i := range times {
+		index[times[i].ID] = &times[i]
+	}
+
+	for _, args := range timeIDBatches(times) {
+		rows, err := db.Query(`
+			SELECT id, swim_time_id, split_num, distance, time_ms
+			FROM swim_splits
+			WHERE swim_time_id IN (`+placeholders(len(args))+`)
+			ORDER BY swim_time_id, split_num`, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var split models.Split
+			if err := rows.Scan(&split.ID, &split.SwimTimeID, &split.SplitNum, &split.Distance, &split.CumulativeMs); err != nil {
+				rows.Close()
+				return err
+			}
+
+			t := index[split.SwimTimeID]
+			split.LapMs = split.CumulativeMs
+			if n := len(t.Splits); n > 0 {
+				split.LapMs -= t.Splits[n-1].CumulativeMs
+			}
+			t.Splits = append(t.Splits, split)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"laplogger/analysis"
+	"laplogger/models"
+)
+
+// GetSplitAnalysis returns a pacing report for a time with splits, compared
+// against the swimmer's fastest other valid flat-start swim with splits in
+// the same event and course
+func (h *TimeHandler) GetSplitAnalysis(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + " WHERE st.id = ? AND s.user_id = ?"
+	timeDetails, err := scanTimeWithDetails(h.db.QueryRow(query, id, userID), format)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	times := []models.SwimTimeWithDetails{*timeDetails}
+
+	var pbID, pbTimeMs int
+	err = h.db.QueryRow(`
+		SELECT st.id, st.time_ms
+		FROM swim_times st
+		WHERE st.swimmer_id = ? AND st.event_id = ? AND st.course = ? AND st.status = 'ok' AND st.start_type = 'flat' AND st.id != ?
+		  AND EXISTS (SELECT 1 FROM swim_splits sp WHERE sp.swim_time_id = st.id)
+		ORDER BY st.time_ms, st.recorded_at, st.id
+		LIMIT 1`,
+		timeDetails.SwimmerID, timeDetails.EventID, timeDetails.Course, id).Scan(&pbID, &pbTimeMs)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hasPB := err == nil
+	if hasPB {
+		times = append(times, models.SwimTimeWithDetails{SwimTime: models.SwimTime{ID: pbID}})
+	}
+
+	if err := loadSplits(h.db, times); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(times[0].Splits) == 0 {
+		http.Error(w, "Time has no splits", http.StatusBadRequest)
+		return
+	}
+
+	var pbSplits []models.Split
+	if hasPB {
+		pbSplits = times[1].Splits
+	}
+
+	report := analysis.AnalyzeSplits(times[0].Splits, pbSplits, timeDetails.Distance)
+	report.TimeID = id
+	report.TimeMs = timeDetails.TimeMs
+	report.FormattedTime = timeDetails.FormattedTime
+	if hasPB {
+		report.PBTimeID = &pbID
+		report.PBTimeMs = &pbTimeMs
+		report.PBFormattedTime = format.Format(pbTimeMs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
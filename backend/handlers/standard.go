@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+type StandardHandler struct {
+	db *sql.DB
+}
+
+func NewStandardHandler(db *sql.DB) *StandardHandler {
+	return &StandardHandler{db: db}
+}
+
+// GetStandards lists the caller's time standards, optionally filtered with
+// ?standard_set=, ?event_id=, ?course=, ?gender= and ?age_group=
+func (h *StandardHandler) GetStandards(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	query := r.URL.Query()
+
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	gender, ok := models.ParseGender(query.Get("gender"))
+	if !ok {
+		http.Error(w, "Gender must be F, M or X", http.StatusBadRequest)
+		return
+	}
+
+	ageGroup := ""
+	if value := query.Get("age_group"); value != "" {
+		ageRange, ok := models.ParseAgeGroup(value)
+		if !ok {
+			http.Error(w, "Invalid age group", http.StatusBadRequest)
+			return
+		}
+		ageGroup = ageRange.Label
+	}
+
+	eventID := 0
+	if value := query.Get("event_id"); value != "" {
+		if eventID, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	standardSet := strings.TrimSpace(query.Get("standard_set"))
+
+	standards, err := queryStandards(h.db, format, standardDetailsQuery+`
+		WHERE ts.user_id = ?
+			AND (? = '' OR ts.standard_set = ?)
+			AND (? = 0 OR ts.event_id = ?)
+			AND (? = '' OR ts.course = ?)
+			AND (? = '' OR ts.gender = ?)
+			AND (? = '' OR ts.age_group = ?)
+		ORDER BY ts.standard_set, e.legs, e.stroke_id, e.units, e.distance, ts.course, ts.age_group, ts.gender, ts.time_ms DESC`,
+		userID, standardSet, standardSet, eventID, eventID, course, course, gender, gender, ageGroup, ageGroup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standards)
+}
+
+func (h *StandardHandler) CreateStandard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var req models.CreateStandardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status, err := validateStandardRequest(h.db, &req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		INSERT INTO time_standards (user_id, standard_set, cut_name, age_group, gender, course, event_id, time_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, req.StandardSet, req.CutName, req.AgeGroup, req.Gender, req.Course, req.EventID, req.TimeMs)
+	if isUniqueViolation(err) {
+		http.Error(w, "This cut already exists in the standard set", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	standard, err := h.getStandard(int(id), userID, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(standard)
+}
+
+func (h *StandardHandler) UpdateStandard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid standard ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateStandardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status, err := validateStandardRequest(h.db, &req); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE time_standards
+		SET standard_set = ?, cut_name = ?, age_group = ?, gender = ?, course = ?, event_id = ?, time_ms = ?
+		WHERE id = ? AND user_id = ?`,
+		req.StandardSet, req.CutName, req.AgeGroup, req.Gender, req.Course, req.EventID, req.TimeMs, id, userID)
+	if isUniqueViolation(err) {
+		http.Error(w, "This cut already exists in the standard set", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Standard not found", http.StatusNotFound)
+		return
+	}
+
+	standard, err := h.getStandard(id, userID, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standard)
+}
+
+func (h *StandardHandler) DeleteStandard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid standard ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec("DELETE FROM time_standards WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Standard not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportStandards loads cuts into the standard set named by ?standard_set=
+// from a CSV file with the columns age group, gender, course, event, cut
+// name and time (MM:SS.hh). Existing cuts are given the imported time. An
+// optional header row is skipped. The file is sent as the request body or
+// as the "file" field of a multipart form. With ?dry_run=true the file is
+// only checked; otherwise it is saved only when every row is valid.
+func (h *StandardHandler) ImportStandards(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	standardSet := strings.TrimSpace(r.URL.Query().Get("standard_set"))
+	if standardSet == "" {
+		http.Error(w, "Standard set is required", http.StatusBadRequest)
+		return
+	}
+
+	file, err := uploadedFile(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	events, err := eventsByKey(h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := importStandards(tx, csv.NewReader(file), events, userID, standardSet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.DryRun = isDryRun(r)
+
+	status := http.StatusOK
+	if len(result.Errors) > 0 {
+		if !result.DryRun {
+			status = http.StatusBadRequest
+		}
+	} else if !result.DryRun {
+		if err := tx.Commit(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// importStandards reads a standards CSV and saves each valid row in tx. Rows
+// that cannot be used are reported in the result rather than returned as
+// errors.
+func importStandards(tx *sql.Tx, reader *csv.Reader, events map[eventKey]int, userID int, standardSet string) (*models.StandardImportResult, error) {
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	result := &models.StandardImportResult{
+		StandardSet:   standardSet,
+		Errors:        []models.ImportError{},
+		UnknownEvents: []string{},
+	}
+	unknown := make(map[string]bool)
+
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Rows++
+			result.Errors = append(result.Errors, models.ImportError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if first && strings.Contains(strings.ToLower(record[0]), "age") {
+			continue
+		}
+		result.Rows++
+
+		req, err := parseStandardRow(record, events)
+		if errors.Is(err, errUnknownEvent) {
+			event := strings.TrimSpace(record[3])
+			if !unknown[event] {
+				unknown[event] = true
+				result.UnknownEvents = append(result.UnknownEvents, event)
+			}
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, models.ImportError{Line: line, Message: err.Error()})
+			continue
+		}
+		req.StandardSet = standardSet
+
+		var id int
+		err = tx.QueryRow(`
+			SELECT id FROM time_standards
+			WHERE user_id = ? AND standard_set = ? AND cut_name = ? AND age_group = ? AND gender = ? AND course = ? AND event_id = ?`,
+			userID, req.StandardSet, req.CutName, req.AgeGroup, req.Gender, req.Course, req.EventID).Scan(&id)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.Exec(`
+				INSERT INTO time_standards (user_id, standard_set, cut_name, age_group, gender, course, event_id, time_ms)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				userID, req.StandardSet, req.CutName, req.AgeGroup, req.Gender, req.Course, req.EventID, req.TimeMs)
+			result.Created++
+		case err == nil:
+			_, err = tx.Exec("UPDATE time_standards SET time_ms = ? WHERE id = ?", req.TimeMs, id)
+			result.Updated++
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// errUnknownEvent is returned by parseStandardRow when the row's event is
+// not one of the individual events
+var errUnknownEvent = errors.New("Unknown event")
+
+// parseStandardRow reads one standards CSV row into a cut, without its standard set
+func parseStandardRow(record []string, events map[eventKey]int) (*models.CreateStandardRequest, error) {
+	if len(record) != 6 {
+		return nil, fmt.Errorf("Expected 6 columns (age group, gender, course, event, cut name, time), got %d", len(record))
+	}
+
+	ageRange, ok := models.ParseAgeGroup(record[0])
+	if !ok {
+		return nil, fmt.Errorf("Invalid age group %q", record[0])
+	}
+
+	gender, ok := models.ParseGender(record[1])
+	if !ok || gender == "" {
+		return nil, fmt.Errorf("Invalid gender %q", record[1])
+	}
+
+	course, ok := models.ParseCourse(record[2])
+	if !ok {
+		return nil, fmt.Errorf("Invalid course %q", record[2])
+	}
+
+	distance, units, stroke, ok := models.ParseEventName(record[3])
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownEvent, record[3])
+	}
+	if units != "" && units != models.CourseUnits(course) {
+		return nil, fmt.Errorf("Event %q is not swum in %s", record[3], course)
+	}
+	eventID, ok := events[eventKey{distance, models.CourseUnits(course), stroke, 1}]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownEvent, record[3])
+	}
+
+	cutName := strings.TrimSpace(record[4])
+	if cutName == "" {
+		return nil, errors.New("Cut name is required")
+	}
+
+	timeMs, err := models.ParseTime(record[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CreateStandardRequest{
+		CutName:  cutName,
+		AgeGroup: ageRange.Label,
+		Gender:   gender,
+		Course:   course,
+		EventID:  eventID,
+		TimeMs:   timeMs,
+	}, nil
+}
+
+// validateStandardRequest checks and normalizes a cut. On failure it returns
+// the HTTP status to respond with.
+func validateStandardRequest(db *sql.DB, req *models.CreateStandardRequest) (int, error) {
+	req.StandardSet = strings.TrimSpace(req.StandardSet)
+	req.CutName = strings.TrimSpace(req.CutName)
+	if req.StandardSet == "" || req.CutName == "" {
+		return http.StatusBadRequest, errors.New("Standard set and cut name are required")
+	}
+
+	var err error
+	if req.TimeMs, err = models.ResolveTime(req.TimeMs, req.Time); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if req.EventID <= 0 || req.TimeMs <= 0 {
+		return http.StatusBadRequest, errors.New("Event ID and Time are required")
+	}
+
+	ageRange, ok := models.ParseAgeGroup(req.AgeGroup)
+	if !ok {
+		return http.StatusBadRequest, errors.New("Age group must look like 10&U, 11-12, 19&O or OPEN")
+	}
+	req.AgeGroup = ageRange.Label
+
+	gender, ok := models.ParseGender(req.Gender)
+	if !ok || gender == "" {
+		return http.StatusBadRequest, errors.New("Gender must be F, M or X")
+	}
+	req.Gender = gender
+
+	var units string
+	var legs int
+	err = db.QueryRow("SELECT units, legs FROM events WHERE id = ?", req.EventID).Scan(&units, &legs)
+	if err == sql.ErrNoRows {
+		return http.StatusBadRequest, errors.New("Event not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if legs > 1 {
+		return http.StatusBadRequest, errors.New("Standards can only be set for individual events")
+	}
+
+	if req.Course == "" {
+		return http.StatusBadRequest, errors.New("Course is required")
+	}
+	if req.Course, err = eventCourse(req.Course, units); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return 0, nil
+}
+
+// standardDetailsQuery selects the columns read by queryStandards, with the
+// standard aliased ts
+const standardDetailsQuery = `
+	SELECT ts.id, ts.standard_set, ts.cut_name, ts.age_group, ts.gender, ts.course, ts.event_id, e.name, ts.time_ms, ts.created_at
+	FROM time_standards ts
+	JOIN events e ON ts.event_id = e.id
+`
+
+// queryStandards runs a query built on standardDetailsQuery and reads every
+// row, writing times in the given format
+func queryStandards(db *sql.DB, format models.TimeFormat, query string, args ...interface{}) ([]models.TimeStandard, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standards := []models.TimeStandard{}
+	for rows.Next() {
+		var ts models.TimeStandard
+		err := rows.Scan(&ts.ID, &ts.StandardSet, &ts.CutName, &ts.AgeGroup, &ts.Gender, &ts.Course,
+			&ts.EventID, &ts.EventName, &ts.TimeMs, &ts.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ts.FormattedTime = format.Format(ts.TimeMs)
+		standards = append(standards, ts)
+	}
+
+	return standards, rows.Err()
+}
+
+// Helper function to get a single standard
+func (h *StandardHandler) getStandard(standardID, userID int, format models.TimeFormat) (*models.TimeStandard, error) {
+	standards, err := queryStandards(h.db, format, standardDetailsQuery+" WHERE ts.id = ? AND ts.user_id = ?", standardID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(standards) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &standards[0], nil
+}
+
+// setCuts are the cuts of one standard set that apply to a time, all in the
+// narrowest of the set's age groups that includes the swimmer
+type setCuts struct {
+	ageRange models.AgeRange
+	cuts     []models.TimeStandard
+}
+
+// loadStandards places each valid flat-start time among the standards its
+// owner has loaded for the swim's event, course, gender and the swimmer's
+// age at the time, once for every standard set, in set order. Times without
+// matching standards are left unannotated.
+func loadStandards(db *sql.DB, times []models.SwimTimeWithDetails, format models.TimeFormat) error {
+	index := make(map[int]*models.SwimTimeWithDetails, len(times))
+	for i := range times {
+		index[times[i].ID] = &times[i]
+	}
+
+	// Cuts of each time by standard set
+	cuts := make(map[int]map[string]*setCuts)
+	for _, args := range timeIDBatches(times) {
+		rows, err := db.Query(`
+			SELECT st.id, ts.id, ts.standard_set, ts.cut_name, ts.age_group, ts.gender, ts.course, ts.event_id, ts.time_ms, ts.created_at
+			FROM swim_times st
+			JOIN swimmers s ON st.swimmer_id = s.id
+			JOIN time_standards ts ON ts.user_id = s.user_id AND ts.event_id = st.event_id
+				AND ts.course = st.course AND ts.gender = s.gender
+			WHERE st.id IN (`+placeholders(len(args))+`)
+				AND st.status = 'ok' AND st.start_type = 'flat' AND st.time_ms > 0`, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var timeID int
+			var ts models.TimeStandard
+			err := rows.Scan(&timeID, &ts.ID, &ts.StandardSet, &ts.CutName, &ts.AgeGroup, &ts.Gender,
+				&ts.Course, &ts.EventID, &ts.TimeMs, &ts.CreatedAt)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			t := index[timeID]
+			ageRange, ok := models.ParseAgeGroup(ts.AgeGroup)
+			if !ok || !ageRange.Contains(t.SwimmerAge) {
+				continue
+			}
+			ts.EventName = t.EventName
+			ts.FormattedTime = format.Format(ts.TimeMs)
+
+			if cuts[timeID] == nil {
+				cuts[timeID] = make(map[string]*setCuts)
+			}
+			set, ok := cuts[timeID][ts.StandardSet]
+			switch {
+			case !ok || ageRange.Narrower(set.ageRange):
+				cuts[timeID][ts.StandardSet] = &setCuts{ageRange: ageRange, cuts: []models.TimeStandard{ts}}
+			case ageRange.Label == set.ageRange.Label:
+				set.cuts = append(set.cuts, ts)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for timeID, sets := range cuts {
+		t := index[timeID]
+		names := make([]string, 0, len(sets))
+		for name := range sets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			achievement := placeTime(t.TimeMs, sets[name].cuts)
+			achievement.StandardSet = name
+			t.Standards = append(t.Standards, *achievement)
+		}
+	}
+
+	return nil
+}
+
+// placeTime finds the fastest cut a time makes and the next faster one
+// among the cuts of a single standard set
+func placeTime(timeMs int, cuts []models.TimeStandard) *models.StandardAchievement {
+	// Slowest (easiest) cut first
+	sort.SliceStable(cuts, func(i, j int) bool { return cuts[i].TimeMs > cuts[j].TimeMs })
+
+	var achievement models.StandardAchievement
+	for i := range cuts {
+		if timeMs <= cuts[i].TimeMs {
+			achievement.Achieved = &cuts[i]
+			continue
+		}
+		achievement.Next = &cuts[i]
+		gap := timeMs - cuts[i].TimeMs
+		achievement.GapMs = &gap
+		break
+	}
+
+	return &achievement
+}
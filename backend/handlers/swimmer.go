@@ -3,13 +3,19 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"laplogger/models"
 )
 
+// swimmerColumns are the columns read by scanSwimmer, in order
+const swimmerColumns = "id, name, COALESCE(email, ''), date_of_birth, COALESCE(gender, ''), COALESCE(club, ''), COALESCE(uss_id, ''), created_at, archived_at"
+
 type SwimmerHandler struct {
 	db *sql.DB
 }
@@ -18,8 +24,36 @@ func NewSwimmerHandler(db *sql.DB) *SwimmerHandler {
 	return &SwimmerHandler{db: db}
 }
 
+// GetSwimmers lists the caller's swimmers. Archived swimmers are only
+// included with ?include_archived=true. Ages are as of today, ?age_on= or
+// the date of ?meet_id=, and the list can be filtered with ?club=,
+// ?gender=, ?age_group=, ?min_age= and ?max_age=.
 func (h *SwimmerHandler) GetSwimmers(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.db.Query("SELECT id, name, email, created_at FROM swimmers ORDER BY name")
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parseDemographicFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	date, status, err := ageDate(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	club := strings.TrimSpace(r.URL.Query().Get("club"))
+	query := "SELECT " + swimmerColumns + " FROM swimmers WHERE user_id = ? AND (? = '' OR club = ? COLLATE NOCASE)"
+	if r.URL.Query().Get("include_archived") != "true" {
+		query += " AND archived_at IS NULL"
+	}
+	query += " ORDER BY name"
+
+	rows, err := h.db.Query(query, userID, club, club)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -28,20 +62,29 @@ func (h *SwimmerHandler) GetSwimmers(w http.ResponseWriter, r *http.Request) {
 
 	var swimmers []models.Swimmer
 	for rows.Next() {
-		var swimmer models.Swimmer
-		err := rows.Scan(&swimmer.ID, &swimmer.Name, &swimmer.Email, &swimmer.CreatedAt)
+		swimmer, err := scanSwimmer(rows)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		swimmers = append(swimmers, swimmer)
+		swimmer.SetAgeOn(date)
+		if filter.matches(swimmer.Gender, swimmer.Age) {
+			swimmers = append(swimmers, *swimmer)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(swimmers)
 }
 
+// GetSwimmer returns a swimmer with their age as of today, ?age_on= or the
+// date of ?meet_id=
 func (h *SwimmerHandler) GetSwimmer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -49,10 +92,13 @@ func (h *SwimmerHandler) GetSwimmer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var swimmer models.Swimmer
-	err = h.db.QueryRow("SELECT id, name, email, created_at FROM swimmers WHERE id = ?", id).
-		Scan(&swimmer.ID, &swimmer.Name, &swimmer.Email, &swimmer.CreatedAt)
-	
+	date, status, err := ageDate(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	swimmer, err := getSwimmer(h.db, id, userID)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Swimmer not found", http.StatusNotFound)
 		return
@@ -61,24 +107,43 @@ func (h *SwimmerHandler) GetSwimmer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	swimmer.SetAgeOn(date)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(swimmer)
 }
 
 func (h *SwimmerHandler) CreateSwimmer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.CreateSwimmerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	swimmer := models.Swimmer{Name: req.Name, Email: req.Email, Gender: req.Gender, Club: req.Club, USSID: req.USSID}
+	var err error
+	if swimmer.DateOfBirth, err = parseDateOfBirth(req.DateOfBirth); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateSwimmer(&swimmer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	result, err := h.db.Exec("INSERT INTO swimmers (name, email) VALUES (?, ?)", req.Name, req.Email)
+	result, err := h.db.Exec(
+		"INSERT INTO swimmers (name, email, date_of_birth, gender, club, uss_id, user_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		swimmer.Name, nullableString(swimmer.Email), nullableDate(swimmer.DateOfBirth),
+		nullableString(swimmer.Gender), nullableString(swimmer.Club), nullableString(swimmer.USSID), userID)
+	if isUniqueViolation(err) {
+		http.Error(w, "A swimmer with this email already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -91,9 +156,7 @@ func (h *SwimmerHandler) CreateSwimmer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return the created swimmer
-	var swimmer models.Swimmer
-	err = h.db.QueryRow("SELECT id, name, email, created_at FROM swimmers WHERE id = ?", id).
-		Scan(&swimmer.ID, &swimmer.Name, &swimmer.Email, &swimmer.CreatedAt)
+	created, err := getSwimmer(h.db, int(id), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -101,5 +164,366 @@ func (h *SwimmerHandler) CreateSwimmer(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateSwimmer replaces a swimmer's profile (PUT)
+func (h *SwimmerHandler) UpdateSwimmer(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateSwimmerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dob, err := parseDateOfBirth(req.DateOfBirth)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.saveSwimmer(w, r, func(swimmer *models.Swimmer) {
+		swimmer.Name = req.Name
+		swimmer.Email = req.Email
+		swimmer.DateOfBirth = dob
+		swimmer.Gender = req.Gender
+		swimmer.Club = req.Club
+		swimmer.USSID = req.USSID
+	})
+}
+
+// PatchSwimmer changes only the profile fields present in the request (PATCH)
+func (h *SwimmerHandler) PatchSwimmer(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateSwimmerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var dob *time.Time
+	if req.DateOfBirth != nil {
+		var err error
+		if dob, err = parseDateOfBirth(*req.DateOfBirth); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.saveSwimmer(w, r, func(swimmer *models.Swimmer) {
+		if req.Name != nil {
+			swimmer.Name = *req.Name
+		}
+		if req.Email != nil {
+			swimmer.Email = *req.Email
+		}
+		if req.DateOfBirth != nil {
+			swimmer.DateOfBirth = dob
+		}
+		if req.Gender != nil {
+			swimmer.Gender = *req.Gender
+		}
+		if req.Club != nil {
+			swimmer.Club = *req.Club
+		}
+		if req.USSID != nil {
+			swimmer.USSID = *req.USSID
+		}
+	})
+}
+
+// ArchiveSwimmer hides a swimmer who has left the club from the swimmer
+// list. Their times are kept.
+func (h *SwimmerHandler) ArchiveSwimmer(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// UnarchiveSwimmer restores an archived swimmer
+func (h *SwimmerHandler) UnarchiveSwimmer(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+// MergeSwimmers moves every time and relay leg from a duplicate swimmer
+// record onto the canonical swimmer in the URL and then deletes the duplicate
+func (h *SwimmerHandler) MergeSwimmers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.MergeSwimmersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.DuplicateID <= 0 {
+		http.Error(w, "Duplicate swimmer ID is required", http.StatusBadRequest)
+		return
+	}
+	if req.DuplicateID == id {
+		http.Error(w, "A swimmer cannot be merged into itself", http.StatusBadRequest)
+		return
+	}
+
+	for _, swimmerID := range []int{id, req.DuplicateID} {
+		if err := checkSwimmerOwner(h.db, swimmerID, userID); err == sql.ErrNoRows {
+			http.Error(w, "Swimmer not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Snapshot the duplicate's times so each move is kept in the audit trail
+	rows, err := tx.Query("SELECT id FROM swim_times WHERE swimmer_id = ?", req.DuplicateID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var timeIDs []int
+	for rows.Next() {
+		var timeID int
+		if err := rows.Scan(&timeID); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timeIDs = append(timeIDs, timeID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, timeID := range timeIDs {
+		old, err := getSwimTime(tx, timeID, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec("UPDATE swim_times SET swimmer_id = ? WHERE id = ?", id, timeID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		moved := *old
+		moved.SwimmerID = id
+		if err := recordTimeAudit(tx, models.AuditActionUpdate, userID, old, &moved); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Earlier audit entries follow their times onto the canonical swimmer
+	if _, err := tx.Exec("UPDATE swim_time_audit SET swimmer_id = ? WHERE swimmer_id = ?", id, req.DuplicateID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE relay_legs SET swimmer_id = ? WHERE swimmer_id = ?", id, req.DuplicateID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM swimmers WHERE id = ?", req.DuplicateID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	swimmer, err := getSwimmer(h.db, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.MergeSwimmersResponse{
+		Swimmer:    *swimmer,
+		MovedTimes: len(timeIDs),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// saveSwimmer loads the swimmer in the URL, applies the changes and writes it back
+func (h *SwimmerHandler) saveSwimmer(w http.ResponseWriter, r *http.Request, apply func(*models.Swimmer)) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+		return
+	}
+
+	swimmer, err := getSwimmer(h.db, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Swimmer not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apply(swimmer)
+
+	if err := validateSwimmer(swimmer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE swimmers SET name = ?, email = ?, date_of_birth = ?, gender = ?, club = ?, uss_id = ? WHERE id = ?",
+		swimmer.Name, nullableString(swimmer.Email), nullableDate(swimmer.DateOfBirth),
+		nullableString(swimmer.Gender), nullableString(swimmer.Club), nullableString(swimmer.USSID), id)
+	if isUniqueViolation(err) {
+		http.Error(w, "A swimmer with this email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	swimmer, err = getSwimmer(h.db, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(swimmer)
+}
+
+func (h *SwimmerHandler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid swimmer ID", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE swimmers SET archived_at = NULL WHERE id = ? AND user_id = ?"
+	if archived {
+		// Keep the original archive date when archiving twice
+		query = "UPDATE swimmers SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP) WHERE id = ? AND user_id = ?"
+	}
+
+	result, err := h.db.Exec(query, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if affected == 0 {
+		http.Error(w, "Swimmer not found", http.StatusNotFound)
+		return
+	}
+
+	swimmer, err := getSwimmer(h.db, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(swimmer)
 }
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSwimmer reads a swimmer selected with swimmerColumns
+func scanSwimmer(row rowScanner) (*models.Swimmer, error) {
+	var swimmer models.Swimmer
+	var dateOfBirth, archivedAt sql.NullTime
+
+	err := row.Scan(&swimmer.ID, &swimmer.Name, &swimmer.Email, &dateOfBirth, &swimmer.Gender, &swimmer.Club,
+		&swimmer.USSID, &swimmer.CreatedAt, &archivedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if dateOfBirth.Valid {
+		swimmer.DateOfBirth = &dateOfBirth.Time
+	}
+	if archivedAt.Valid {
+		swimmer.ArchivedAt = &archivedAt.Time
+	}
+	swimmer.SetAgeOn(time.Now())
+
+	return &swimmer, nil
+}
+
+// getSwimmer returns sql.ErrNoRows unless the swimmer exists and belongs to the user
+func getSwimmer(db *sql.DB, swimmerID, userID int) (*models.Swimmer, error) {
+	row := db.QueryRow("SELECT "+swimmerColumns+" FROM swimmers WHERE id = ? AND user_id = ?", swimmerID, userID)
+	return scanSwimmer(row)
+}
+
+// validateSwimmer checks and normalizes a swimmer's profile before it is saved
+func validateSwimmer(swimmer *models.Swimmer) error {
+	swimmer.Name = strings.TrimSpace(swimmer.Name)
+	if swimmer.Name == "" {
+		return errors.New("Name is required")
+	}
+
+	gender, ok := models.ParseGender(swimmer.Gender)
+	if !ok {
+		return errors.New("Gender must be F, M or X")
+	}
+	swimmer.Gender = gender
+	swimmer.Club = strings.TrimSpace(swimmer.Club)
+	swimmer.USSID = strings.ToUpper(strings.TrimSpace(swimmer.USSID))
+
+	return nil
+}
+
+// checkSwimmerOwner returns sql.ErrNoRows unless the swimmer exists and belongs to the user
+func checkSwimmerOwner(db *sql.DB, swimmerID, userID int) error {
+	var id int
+	return db.QueryRow("SELECT id FROM swimmers WHERE id = ? AND user_id = ?", swimmerID, userID).Scan(&id)
+}
+
+// nullableString stores blank optional text as NULL so UNIQUE columns allow
+// any number of blank values
+func nullableString(value string) sql.NullString {
+	value = strings.TrimSpace(value)
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"laplogger/models"
@@ -19,23 +22,48 @@ func NewTimeHandler(db *sql.DB) *TimeHandler {
 }
 
 func (h *TimeHandler) CreateTime(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	var req models.CreateTimeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Validate required fields
-	if req.SwimmerID <= 0 || req.EventID <= 0 || req.TimeMs <= 0 {
-		http.Error(w, "Swimmer ID, Event ID, and Time are required", http.StatusBadRequest)
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	splits, status, err := validateTimeRequest(h.db, &req, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Look up the best time before this swim is recorded
+	previousBest, err := getPreviousBest(tx, req.SwimmerID, req.EventID, req.Course)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Insert the time
-	result, err := h.db.Exec(`
-		INSERT INTO swim_times (swimmer_id, event_id, meet_id, time_ms, notes) 
-		VALUES (?, ?, ?, ?, ?)`,
-		req.SwimmerID, req.EventID, req.MeetID, req.TimeMs, req.Notes)
+	result, err := tx.Exec(`
+		INSERT INTO swim_times (swimmer_id, event_id, meet_id, time_ms, course, start_type, status, dq_code, notes) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.SwimmerID, req.EventID, req.MeetID, req.TimeMs, req.Course, req.StartType, req.Status, nullableString(req.DQCode), req.Notes)
 	
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -48,19 +76,212 @@ func (h *TimeHandler) CreateTime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := saveSplits(tx, int(id), splits); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := getSwimTime(tx, int(id), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := recordTimeAudit(tx, models.AuditActionCreate, userID, nil, created); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Return the created time with details
-	timeWithDetails, err := h.getTimeWithDetails(int(id))
+	timeWithDetails, err := h.getTimeWithDetails(int(id), format)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	response := models.CreateTimeResponse{
+		SwimTimeWithDetails: *timeWithDetails,
+	}
+	if req.StartType == models.StartFlat && req.Status == models.ResultOK {
+		applyPersonalBest(&response, previousBest)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateTime replaces a recorded time, keeping the previous values in the audit trail
+func (h *TimeHandler) UpdateTime(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateTimeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	splits, status, err := validateTimeRequest(h.db, &req, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := getSwimTime(tx, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Recorded splits must keep matching the time, so a change to the time or
+	// event has to come with new splits. A result without a time loses its splits.
+	if len(splits) == 0 && req.TimeMs > 0 && (req.TimeMs != old.TimeMs || req.EventID != old.EventID) {
+		count, err := countSplits(tx, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if count > 0 {
+			http.Error(w, "Time has splits that would no longer match; send new splits with the update", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(splits) > 0 || req.TimeMs == 0 {
+		if err := saveSplits(tx, id, splits); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE swim_times SET swimmer_id = ?, event_id = ?, meet_id = ?, time_ms = ?, course = ?, start_type = ?,
+			status = ?, dq_code = ?, notes = ?
+		WHERE id = ?`,
+		req.SwimmerID, req.EventID, req.MeetID, req.TimeMs, req.Course, req.StartType,
+		req.Status, nullableString(req.DQCode), req.Notes, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := getSwimTime(tx, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := recordTimeAudit(tx, models.AuditActionUpdate, userID, old, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	timeWithDetails, err := h.getTimeWithDetails(id, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(timeWithDetails)
 }
 
+// DeleteTime removes a recorded time. The deleted values stay in the audit trail.
+func (h *TimeHandler) DeleteTime(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := getSwimTime(tx, id, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM swim_times WHERE id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM swim_splits WHERE swim_time_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := recordTimeAudit(tx, models.AuditActionDelete, userID, old, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTimesBySwimmer lists a swimmer's times, optionally limited to one course
+// with ?course= and to the swimmer's age at the time with ?age_group=,
+// ?min_age= and ?max_age=. With ?convert_to= each time also carries its
+// equivalent in that course.
 func (h *TimeHandler) GetTimesBySwimmer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	swimmerID, err := strconv.Atoi(vars["swimmer_id"])
 	if err != nil {
@@ -68,55 +289,273 @@ func (h *TimeHandler) GetTimesBySwimmer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	times, err := h.getTimesWithDetailsBySwimmer(swimmerID)
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseDemographicFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	convertTo := ""
+	if value := r.URL.Query().Get("convert_to"); value != "" {
+		var ok bool
+		if convertTo, ok = models.ParseCourse(value); !ok {
+			http.Error(w, "Convert to must be SCY, SCM or LCM", http.StatusBadRequest)
+			return
+		}
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
 	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if err := checkSwimmerOwner(h.db, swimmerID, userID); err == sql.ErrNoRows {
+		http.Error(w, "Swimmer not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	times, err := h.getTimesWithDetailsBySwimmer(swimmerID, course, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	times = filterTimes(times, filter)
+
+	if convertTo != "" {
+		for i := range times {
+			if times[i].Converted, err = convertTime(h.db, &times[i], convertTo, format); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(times)
 }
 
+// GetAllTimes lists all of the caller's times, optionally limited to one
+// course with ?course= and by the swimmer's gender and age at the time with
+// ?gender=, ?age_group=, ?min_age= and ?max_age=
 func (h *TimeHandler) GetAllTimes(w http.ResponseWriter, r *http.Request) {
-	times, err := h.getAllTimesWithDetails()
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	course, err := courseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseDemographicFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format, status, err := timeFormat(h.db, r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	times, err := h.getAllTimesWithDetails(userID, course, format)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	times = filterTimes(times, filter)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(times)
 }
 
-// Helper function to get a single time with details
-func (h *TimeHandler) getTimeWithDetails(timeID int) (*models.SwimTimeWithDetails, error) {
-	query := `
-		SELECT 
-			st.id, st.swimmer_id, st.event_id, st.meet_id, st.time_ms, st.notes, st.recorded_at,
-			s.name as swimmer_name,
-			e.name as event_name,
-			str.name as stroke_name,
-			e.distance,
-			m.name as meet_name
-		FROM swim_times st
-		JOIN swimmers s ON st.swimmer_id = s.id
-		JOIN events e ON st.event_id = e.id
-		JOIN strokes str ON e.stroke_id = str.id
-		LEFT JOIN meets m ON st.meet_id = m.id
-		WHERE st.id = ?
-	`
+// filterTimes keeps the times swum by swimmers matching the filter at the time of the swim
+func filterTimes(times []models.SwimTimeWithDetails, filter demographicFilter) []models.SwimTimeWithDetails {
+	kept := times[:0]
+	for _, t := range times {
+		if filter.matches(t.SwimmerGender, t.SwimmerAge) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// courseFilter reads the optional ?course= query parameter, returning "" when it is absent
+func courseFilter(r *http.Request) (string, error) {
+	value := r.URL.Query().Get("course")
+	if value == "" {
+		return "", nil
+	}
+
+	course, ok := models.ParseCourse(value)
+	if !ok {
+		return "", errors.New("Course must be SCY, SCM or LCM")
+	}
+	return course, nil
+}
+
+// validateTimeRequest checks the required fields of a time and that the
+// swimmer and meet belong to the user, and returns the request's splits
+// checked against the event. On failure it returns the HTTP status to
+// respond with.
+func validateTimeRequest(db *sql.DB, req *models.CreateTimeRequest, userID int) ([]models.Split, int, error) {
+	var err error
+	status, ok := models.ParseResultStatus(req.Status)
+	if !ok {
+		return nil, http.StatusBadRequest, errors.New("Status must be ok, dq, dns, dnf or scratch")
+	}
+	req.Status = status
+
+	if req.TimeMs, err = models.ResolveTime(req.TimeMs, req.Time); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if req.SwimmerID <= 0 || req.EventID <= 0 || (status == models.ResultOK && req.TimeMs <= 0) {
+		return nil, http.StatusBadRequest, errors.New("Swimmer ID, Event ID, and Time are required")
+	}
+
+	// Only a disqualified swim has an infraction, and only finished or
+	// disqualified swims have a time
+	switch status {
+	case models.ResultDQ:
+		infraction, ok := models.LookupInfraction(req.DQCode)
+		if !ok {
+			return nil, http.StatusBadRequest, errors.New("A DQ needs a DQ code from /api/dq-codes")
+		}
+		req.DQCode = infraction.Code
+		if req.TimeMs < 0 {
+			return nil, http.StatusBadRequest, errors.New("Time cannot be negative")
+		}
+	default:
+		if req.DQCode != "" {
+			return nil, http.StatusBadRequest, errors.New("A DQ code can only be given for a DQ")
+		}
+		if status != models.ResultOK && req.TimeMs != 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("A %s result cannot have a time", status)
+		}
+	}
+	if req.TimeMs == 0 && len(req.Splits) > 0 {
+		return nil, http.StatusBadRequest, errors.New("Splits can only be recorded for a swim with a time")
+	}
+
+	var units string
+	var distance, legs int
+	err = db.QueryRow("SELECT units, distance, legs FROM events WHERE id = ?", req.EventID).Scan(&units, &distance, &legs)
+	if err == sql.ErrNoRows {
+		return nil, http.StatusBadRequest, errors.New("Event not found")
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if legs > 1 {
+		return nil, http.StatusBadRequest, errors.New("Relay times are recorded through /api/relays")
+	}
+
+	if req.Course, err = eventCourse(req.Course, units); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	switch req.StartType {
+	case "":
+		req.StartType = models.StartFlat
+	case models.StartFlat, models.StartRelay:
+	default:
+		return nil, http.StatusBadRequest, errors.New("Start type must be flat or relay")
+	}
+
+	var splits []models.Split
+	if len(req.Splits) > 0 {
+		if splits, err = models.BuildSplits(req.SplitType, req.Splits, distance, req.TimeMs); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+
+	// The swimmer and meet must belong to the caller
+	if err := checkSwimmerOwner(db, req.SwimmerID, userID); err == sql.ErrNoRows {
+		return nil, http.StatusNotFound, errors.New("Swimmer not found")
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if req.MeetID != nil {
+		if err := checkMeetOwner(db, *req.MeetID, userID); err == sql.ErrNoRows {
+			return nil, http.StatusNotFound, errors.New("Meet not found")
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	return splits, 0, nil
+}
 
+// eventCourse validates the course of a swim in an event measured in units.
+// Yards events can only be swum short course; meters events default to long course.
+func eventCourse(value, units string) (string, error) {
+	if value == "" {
+		if units == models.UnitsYards {
+			return models.CourseSCY, nil
+		}
+		return models.DefaultCourse, nil
+	}
+
+	course, ok := models.ParseCourse(value)
+	if !ok {
+		return "", errors.New("Course must be SCY, SCM or LCM")
+	}
+	if models.CourseUnits(course) != units {
+		return "", fmt.Errorf("Course %s cannot be used for a %s event", course, units)
+	}
+	return course, nil
+}
+
+// timeDetailsColumns are the columns read by scanTimeWithDetails, in order.
+// They expect the swim time to be aliased st and joined with timeDetailsJoins.
+const timeDetailsColumns = `
+	st.id, st.swimmer_id, st.event_id, st.meet_id, st.time_ms, st.course, st.start_type,
+	st.status, COALESCE(st.dq_code, ''), st.round, COALESCE(st.notes, ''), st.recorded_at,
+	s.name as swimmer_name,
+	s.date_of_birth,
+	COALESCE(s.gender, ''),
+	e.name as event_name,
+	str.name as stroke_name,
+	e.distance,
+	e.units,
+	m.name as meet_name,
+	m.meet_date
+`
+
+const timeDetailsJoins = `
+	JOIN swimmers s ON st.swimmer_id = s.id
+	JOIN events e ON st.event_id = e.id
+	JOIN strokes str ON e.stroke_id = str.id
+	LEFT JOIN meets m ON st.meet_id = m.id
+`
+
+// scanTimeWithDetails reads a time selected with timeDetailsColumns, writing
+// it in the given format
+func scanTimeWithDetails(row rowScanner, format models.TimeFormat) (*models.SwimTimeWithDetails, error) {
 	var timeDetails models.SwimTimeWithDetails
 	var meetName sql.NullString
-
-	err := h.db.QueryRow(query, timeID).Scan(
-		&timeDetails.ID, &timeDetails.SwimmerID, &timeDetails.EventID, 
-		&timeDetails.MeetID, &timeDetails.TimeMs, &timeDetails.Notes, &timeDetails.RecordedAt,
-		&timeDetails.SwimmerName, &timeDetails.EventName, &timeDetails.StrokeName,
-		&timeDetails.Distance, &meetName,
+	var dateOfBirth, meetDate sql.NullTime
+
+	err := row.Scan(
+		&timeDetails.ID, &timeDetails.SwimmerID, &timeDetails.EventID,
+		&timeDetails.MeetID, &timeDetails.TimeMs, &timeDetails.Course, &timeDetails.StartType,
+		&timeDetails.Status, &timeDetails.DQCode, &timeDetails.Round, &timeDetails.Notes, &timeDetails.RecordedAt,
+		&timeDetails.SwimmerName, &dateOfBirth, &timeDetails.SwimmerGender, &timeDetails.EventName, &timeDetails.StrokeName,
+		&timeDetails.Distance, &timeDetails.Units, &meetName, &meetDate,
 	)
-
 	if err != nil {
 		return nil, err
 	}
@@ -125,32 +564,32 @@ func (h *TimeHandler) getTimeWithDetails(timeID int) (*models.SwimTimeWithDetail
 		timeDetails.MeetName = &meetName.String
 	}
 
+	// Meet swims use the swimmer's age on the meet date
+	if dateOfBirth.Valid {
+		swamOn := timeDetails.RecordedAt
+		if meetDate.Valid {
+			swamOn = meetDate.Time
+		}
+		age := models.AgeOn(dateOfBirth.Time, swamOn)
+		timeDetails.SwimmerAge = &age
+		timeDetails.AgeGroup = models.AgeGroup(age)
+	}
+
 	// Format the time
-	timeDetails.FormattedTime = timeDetails.SwimTime.FormatTime()
+	if timeDetails.TimeMs > 0 {
+		timeDetails.FormattedTime = format.Format(timeDetails.TimeMs)
+	}
+	if infraction, ok := models.LookupInfraction(timeDetails.DQCode); ok {
+		timeDetails.DQReason = infraction.Description
+	}
 
 	return &timeDetails, nil
 }
 
-// Helper function to get times with details by swimmer
-func (h *TimeHandler) getTimesWithDetailsBySwimmer(swimmerID int) ([]models.SwimTimeWithDetails, error) {
-	query := `
-		SELECT 
-			st.id, st.swimmer_id, st.event_id, st.meet_id, st.time_ms, st.notes, st.recorded_at,
-			s.name as swimmer_name,
-			e.name as event_name,
-			str.name as stroke_name,
-			e.distance,
-			m.name as meet_name
-		FROM swim_times st
-		JOIN swimmers s ON st.swimmer_id = s.id
-		JOIN events e ON st.event_id = e.id
-		JOIN strokes str ON e.stroke_id = str.id
-		LEFT JOIN meets m ON st.meet_id = m.id
-		WHERE st.swimmer_id = ?
-		ORDER BY st.recorded_at DESC
-	`
-
-	rows, err := h.db.Query(query, swimmerID)
+// queryTimesWithDetails runs a query selecting timeDetailsColumns and reads
+// every row, writing times in the given format
+func queryTimesWithDetails(db *sql.DB, format models.TimeFormat, query string, args ...interface{}) ([]models.SwimTimeWithDetails, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,82 +597,75 @@ func (h *TimeHandler) getTimesWithDetailsBySwimmer(swimmerID int) ([]models.Swim
 
 	var times []models.SwimTimeWithDetails
 	for rows.Next() {
-		var timeDetails models.SwimTimeWithDetails
-		var meetName sql.NullString
-
-		err := rows.Scan(
-			&timeDetails.ID, &timeDetails.SwimmerID, &timeDetails.EventID,
-			&timeDetails.MeetID, &timeDetails.TimeMs, &timeDetails.Notes, &timeDetails.RecordedAt,
-			&timeDetails.SwimmerName, &timeDetails.EventName, &timeDetails.StrokeName,
-			&timeDetails.Distance, &meetName,
-		)
-
+		timeDetails, err := scanTimeWithDetails(rows, format)
 		if err != nil {
 			return nil, err
 		}
+		times = append(times, *timeDetails)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		if meetName.Valid {
-			timeDetails.MeetName = &meetName.String
-		}
+	if err := loadSplits(db, times); err != nil {
+		return nil, err
+	}
+	if err := loadStandards(db, times, format); err != nil {
+		return nil, err
+	}
 
-		// Format the time
-		timeDetails.FormattedTime = timeDetails.SwimTime.FormatTime()
+	return times, nil
+}
 
-		times = append(times, timeDetails)
+// timeIDBatchSize limits how many time IDs go into one IN (...) list
+const timeIDBatchSize = 500
+
+// timeIDBatches splits the IDs of times into query arguments for IN (...)
+// lists of at most timeIDBatchSize
+func timeIDBatches(times []models.SwimTimeWithDetails) [][]interface{} {
+	var batches [][]interface{}
+	for start := 0; start < len(times); start += timeIDBatchSize {
+		end := min(start+timeIDBatchSize, len(times))
+		args := make([]interface{}, 0, end-start)
+		for _, t := range times[start:end] {
+			args = append(args, t.ID)
+		}
+		batches = append(batches, args)
 	}
+	return batches
+}
 
-	return times, nil
+// placeholders returns n comma-separated query placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
 
-// Helper function to get all times with details
-func (h *TimeHandler) getAllTimesWithDetails() ([]models.SwimTimeWithDetails, error) {
-	query := `
-		SELECT 
-			st.id, st.swimmer_id, st.event_id, st.meet_id, st.time_ms, st.notes, st.recorded_at,
-			s.name as swimmer_name,
-			e.name as event_name,
-			str.name as stroke_name,
-			e.distance,
-			m.name as meet_name
-		FROM swim_times st
-		JOIN swimmers s ON st.swimmer_id = s.id
-		JOIN events e ON st.event_id = e.id
-		JOIN strokes str ON e.stroke_id = str.id
-		LEFT JOIN meets m ON st.meet_id = m.id
-		ORDER BY st.recorded_at DESC
-	`
-
-	rows, err := h.db.Query(query)
+// Helper function to get a single time with details
+func (h *TimeHandler) getTimeWithDetails(timeID int, format models.TimeFormat) (*models.SwimTimeWithDetails, error) {
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + " WHERE st.id = ?"
+	times, err := queryTimesWithDetails(h.db, format, query, timeID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var times []models.SwimTimeWithDetails
-	for rows.Next() {
-		var timeDetails models.SwimTimeWithDetails
-		var meetName sql.NullString
-
-		err := rows.Scan(
-			&timeDetails.ID, &timeDetails.SwimmerID, &timeDetails.EventID,
-			&timeDetails.MeetID, &timeDetails.TimeMs, &timeDetails.Notes, &timeDetails.RecordedAt,
-			&timeDetails.SwimmerName, &timeDetails.EventName, &timeDetails.StrokeName,
-			&timeDetails.Distance, &meetName,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		if meetName.Valid {
-			timeDetails.MeetName = &meetName.String
-		}
-
-		// Format the time
-		timeDetails.FormattedTime = timeDetails.SwimTime.FormatTime()
-
-		times = append(times, timeDetails)
+	if len(times) == 0 {
+		return nil, sql.ErrNoRows
 	}
+	return &times[0], nil
+}
 
-	return times, nil
+// Helper function to get times with details by swimmer, optionally for one course
+func (h *TimeHandler) getTimesWithDetailsBySwimmer(swimmerID int, course string, format models.TimeFormat) ([]models.SwimTimeWithDetails, error) {
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + `
+		WHERE st.swimmer_id = ? AND (? = '' OR st.course = ?)
+		ORDER BY st.recorded_at DESC`
+	return queryTimesWithDetails(h.db, format, query, swimmerID, course, course)
+}
+
+// Helper function to get all of a user's times with details, optionally for one course
+func (h *TimeHandler) getAllTimesWithDetails(userID int, course string, format models.TimeFormat) ([]models.SwimTimeWithDetails, error) {
+	query := "SELECT " + timeDetailsColumns + " FROM swim_times st " + timeDetailsJoins + `
+		WHERE s.user_id = ? AND (? = '' OR st.course = ?)
+		ORDER BY st.recorded_at DESC`
+	return queryTimesWithDetails(h.db, format, query, userID, course, course)
 }
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"laplogger/models"
+)
+
+// GetTimeHistory returns the audit trail of a time entry, oldest change first.
+// The history of deleted times remains available.
+func (h *TimeHandler) GetTimeHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid time ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT
+			a.id, a.swim_time_id, a.action, a.changed_by, u.username, a.changed_at,
+			a.old_value, a.new_value
+		FROM swim_time_audit a
+		JOIN swimmers s ON a.swimmer_id = s.id
+		JOIN users u ON a.changed_by = u.id
+		WHERE a.swim_time_id = ? AND s.user_id = ?
+		ORDER BY a.id
+	`
+
+	rows, err := h.db.Query(query, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var history []models.SwimTimeAudit
+	for rows.Next() {
+		var entry models.SwimTimeAudit
+		var oldValue, newValue sql.NullString
+
+		err := rows.Scan(
+			&entry.ID, &entry.SwimTimeID, &entry.Action, &entry.ChangedBy, &entry.ChangedByName,
+			&entry.ChangedAt, &oldValue, &newValue,
+		)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if entry.OldValue, err = decodeAuditValue(oldValue); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if entry.NewValue, err = decodeAuditValue(newValue); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(history) == 0 {
+		http.Error(w, "Time not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// getSwimTime reads a single time within a transaction, returning
+// sql.ErrNoRows unless its swimmer belongs to the user
+func getSwimTime(tx *sql.Tx, timeID, userID int) (*models.SwimTime, error) {
+	var st models.SwimTime
+	err := tx.QueryRow(`
+		SELECT st.id, st.swimmer_id, st.event_id, st.meet_id, st.time_ms, st.course, st.start_type,
+			st.status, COALESCE(st.dq_code, ''), st.round, COALESCE(st.notes, ''), st.recorded_at
+		FROM swim_times st
+		JOIN swimmers s ON st.swimmer_id = s.id
+		WHERE st.id = ? AND s.user_id = ?`, timeID, userID).
+		Scan(&st.ID, &st.SwimmerID, &st.EventID, &st.MeetID, &st.TimeMs, &st.Course, &st.StartType,
+			&st.Status, &st.DQCode, &st.Round, &st.Notes, &st.RecordedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
+
+// recordTimeAudit stores a snapshot of a time before and after a change.
+// oldValue is nil for creations and newValue is nil for deletions.
+func recordTimeAudit(tx *sql.Tx, action string, userID int, oldValue, newValue *models.SwimTime) error {
+	current := newValue
+	if current == nil {
+		current = oldValue
+	}
+
+	oldJSON, err := encodeAuditValue(oldValue)
+	if err != nil {
+		return err
+	}
+	newJSON, err := encodeAuditValue(newValue)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO swim_time_audit (swim_time_id, swimmer_id, action, changed_by, old_value, new_value)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		current.ID, current.SwimmerID, action, userID, oldJSON, newJSON)
+	return err
+}
+
+func encodeAuditValue(value *models.SwimTime) (sql.NullString, error) {
+	if value == nil {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func decodeAuditValue(value sql.NullString) (*models.SwimTime, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	var st models.SwimTime
+	if err := json.Unmarshal([]byte(value.String), &st); err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
@@ -0,0 +1,668 @@
+// Package lenex reads and writes LENEX 3.0, the XML format European and
+// international meets exchange programs, entries and results in. LENEX
+// files are plain XML (.lef) or a zip archive holding one (.lxf).
+//
+// Parse reads a meet's sessions, events, and the individual and relay
+// results of every club into a results file. Write does the reverse for a
+// club's results at a meet.
+package lenex
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// dateLayout is the layout of LENEX dates
+const dateLayout = "2006-01-02"
+
+// noTime is the swim time LENEX writes for a result without a time
+const noTime = "NT"
+
+// strokes maps LENEX stroke codes to stroke names. MEDLEY is the individual
+// medley for individual events and the medley relay for relays.
+var strokes = map[string]string{
+	"FREE":   "Freestyle",
+	"BACK":   "Backstroke",
+	"BREAST": "Breaststroke",
+	"FLY":    "Butterfly",
+	"MEDLEY": models.RelayStrokeMedley,
+}
+
+// rounds maps LENEX round codes to rounds. Timed finals (TIM) and fastest
+// heats (FHT) are finals.
+var rounds = map[string]string{
+	"TIM": models.RoundFinals,
+	"FHT": models.RoundFinals,
+	"FIN": models.RoundFinals,
+	"SEM": models.RoundSemiFinals,
+	"QUA": models.RoundQuarterFinals,
+	"PRE": models.RoundPrelims,
+	"SOP": models.RoundSwimOff,
+	"SOS": models.RoundSwimOff,
+	"SOQ": models.RoundSwimOff,
+}
+
+// statuses maps LENEX result status codes to result statuses. Exhibition
+// swims (EXH) keep their time.
+var statuses = map[string]string{
+	"":     models.ResultOK,
+	"EXH":  models.ResultOK,
+	"DSQ":  models.ResultDQ,
+	"DNS":  models.ResultDNS,
+	"SICK": models.ResultDNS,
+	"DNF":  models.ResultDNF,
+	"WDR":  models.ResultScratch,
+}
+
+// course maps a LENEX course code to a course. Pools of unusual lengths,
+// such as SCM33, count as the nearest standard course; OPEN water has none.
+func course(code string) (string, bool) {
+	code = strings.ToUpper(code)
+	for _, c := range []string{models.CourseLCM, models.CourseSCM, models.CourseSCY} {
+		if strings.HasPrefix(code, c) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// The elements below are shared by Parse and Write. Parse reads the outer
+// elements attribute by attribute as it streams through a file, and decodes
+// EVENT and RESULT elements whole.
+
+type lenexXML struct {
+	XMLName     xml.Name       `xml:"LENEX"`
+	Version     string         `xml:"version,attr"`
+	Constructor constructorXML `xml:"CONSTRUCTOR"`
+	Meets       []meetXML      `xml:"MEETS>MEET"`
+}
+
+type constructorXML struct {
+	Name    string     `xml:"name,attr"`
+	Version string     `xml:"version,attr"`
+	Contact contactXML `xml:"CONTACT"`
+}
+
+type contactXML struct {
+	Name  string `xml:"name,attr,omitempty"`
+	Email string `xml:"email,attr"`
+}
+
+type meetXML struct {
+	Name     string       `xml:"name,attr"`
+	City     string       `xml:"city,attr"`
+	Nation   string       `xml:"nation,attr,omitempty"`
+	Course   string       `xml:"course,attr,omitempty"`
+	Sessions []sessionXML `xml:"SESSIONS>SESSION,omitempty"`
+	Clubs    []clubXML    `xml:"CLUBS>CLUB,omitempty"`
+}
+
+type sessionXML struct {
+	Number int        `xml:"number,attr"`
+	Name   string     `xml:"name,attr,omitempty"`
+	Date   string     `xml:"date,attr"`
+	Course string     `xml:"course,attr,omitempty"`
+	Events []eventXML `xml:"EVENTS>EVENT,omitempty"`
+}
+
+type eventXML struct {
+	EventID   string       `xml:"eventid,attr"`
+	Number    int          `xml:"number,attr"`
+	Round     string       `xml:"round,attr,omitempty"`
+	SwimStyle swimStyleXML `xml:"SWIMSTYLE"`
+}
+
+type swimStyleXML struct {
+	Distance   int    `xml:"distance,attr"` // Of each leg for relays
+	RelayCount int    `xml:"relaycount,attr"`
+	Stroke     string `xml:"stroke,attr"`
+}
+
+type clubXML struct {
+	Name     string       `xml:"name,attr"`
+	Athletes []athleteXML `xml:"ATHLETES>ATHLETE,omitempty"`
+	Relays   []relayXML   `xml:"RELAYS>RELAY,omitempty"`
+}
+
+type athleteXML struct {
+	AthleteID  string      `xml:"athleteid,attr"`
+	FirstName  string      `xml:"firstname,attr"`
+	NamePrefix string      `xml:"nameprefix,attr,omitempty"`
+	LastName   string      `xml:"lastname,attr"`
+	BirthDate  string      `xml:"birthdate,attr,omitempty"`
+	Gender     string      `xml:"gender,attr,omitempty"`
+	License    string      `xml:"license,attr,omitempty"`
+	Results    []resultXML `xml:"RESULTS>RESULT,omitempty"`
+}
+
+type relayXML struct {
+	Number  int         `xml:"number,attr"`
+	Results []resultXML `xml:"RESULTS>RESULT,omitempty"`
+}
+
+type resultXML struct {
+	ResultID  string             `xml:"resultid,attr,omitempty"`
+	EventID   string             `xml:"eventid,attr"`
+	SwimTime  string             `xml:"swimtime,attr"`
+	Status    string             `xml:"status,attr,omitempty"`
+	Splits    []splitXML         `xml:"SPLITS>SPLIT,omitempty"`
+	Positions []relayPositionXML `xml:"RELAYPOSITIONS>RELAYPOSITION,omitempty"`
+}
+
+type splitXML struct {
+	Distance int    `xml:"distance,attr"`
+	SwimTime string `xml:"swimtime,attr"`
+}
+
+type relayPositionXML struct {
+	AthleteID string      `xml:"athleteid,attr,omitempty"`
+	Number    int         `xml:"number,attr"`
+	Athlete   *athleteXML `xml:"ATHLETE"` // Swimmers not listed in the club
+}
+
+// event is an event of the meet being read
+type event struct {
+	number   int
+	distance int // Of each leg for relays
+	legs     int
+	stroke   string
+	course   string
+	round    string
+	date     time.Time
+}
+
+// pendingRelay is a relay whose legs name athletes that may be listed
+// anywhere in the file
+type pendingRelay struct {
+	index     int
+	club      string
+	positions []relayPositionXML
+	splits    map[int]int // Cumulative time by distance
+}
+
+// parser holds the state carried through a file
+type parser struct {
+	dec    *xml.Decoder
+	file   models.ResultsFile
+	errors []models.ImportError
+	meets  int
+
+	course  string // Course of the meet, then of the session being read
+	session struct {
+		name string
+		date time.Time
+	}
+	events  map[string]event
+	skipped map[string]bool // Events that cannot be imported, already reported
+
+	club     string
+	athletes map[string]models.ImportedSwimmer // By athlete ID
+	athlete  *models.ImportedSwimmer           // Athlete whose results are being read
+	relay    int                               // Number of the relay being read, 0 outside relays
+	pending  []pendingRelay
+}
+
+// maxFileSize is the largest LENEX file read, before and after unzipping,
+// so a small archive cannot expand to fill memory
+const maxFileSize = 50 << 20
+
+// Parse reads a LENEX file, zipped or not. Elements that cannot be read are
+// returned as import errors alongside the results that could be.
+func Parse(r io.Reader) (*models.ResultsFile, []models.ImportError, error) {
+	data, err := readLimited(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		if data, err = unzip(data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	p := &parser{
+		dec:      xml.NewDecoder(bytes.NewReader(data)),
+		events:   make(map[string]event),
+		skipped:  make(map[string]bool),
+		athletes: make(map[string]models.ImportedSwimmer),
+	}
+	p.dec.CharsetReader = charsetReader
+	if err := p.parse(); err != nil {
+		return nil, nil, err
+	}
+
+	if p.meets == 0 {
+		return nil, nil, errors.New("File has no MEET element")
+	}
+	if p.file.Meet.Date.IsZero() {
+		return nil, nil, errors.New("Meet has no dated session")
+	}
+	p.finishRelays()
+
+	return &p.file, p.errors, nil
+}
+
+// unzip returns the LENEX file inside an .lxf archive
+func unzip(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid LXF archive: %w", err)
+	}
+	for _, f := range archive.File {
+		if !strings.HasSuffix(strings.ToLower(f.Name), ".lef") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return readLimited(rc)
+	}
+	return nil, errors.New("LXF archive holds no .lef file")
+}
+
+// readLimited reads a whole file unless it is larger than maxFileSize
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("LENEX file is larger than %d MB", maxFileSize>>20)
+	}
+	return data, nil
+}
+
+// charsetReader decodes files in the Latin-1 encodings many LENEX exporters
+// write. Windows-1252 is read as Latin-1, which differs only in a few
+// punctuation marks.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+	default:
+		return nil, fmt.Errorf("Unsupported character set %q", charset)
+	}
+
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return strings.NewReader(string(runes)), nil
+}
+
+func (p *parser) parse() error {
+	for {
+		line, _ := p.dec.InputPos()
+		token, err := p.dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid LENEX file: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := p.start(t, line); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "ATHLETE":
+				p.athlete = nil
+			case "RELAY":
+				p.relay = 0
+			case "CLUB":
+				p.club = ""
+			}
+		}
+	}
+}
+
+// start reads the element t starting on line
+func (p *parser) start(t xml.StartElement, line int) error {
+	attr := func(name string) string {
+		for _, a := range t.Attr {
+			if a.Name.Local == name {
+				return strings.TrimSpace(a.Value)
+			}
+		}
+		return ""
+	}
+
+	switch t.Name.Local {
+	case "MEET":
+		p.meets++
+		if p.meets > 1 {
+			return errors.New("File holds more than one meet; import them one at a time")
+		}
+		p.file.Meet.Name = attr("name")
+		p.file.Meet.Location = attr("city")
+		if nation := attr("nation"); nation != "" {
+			if p.file.Meet.Location != "" {
+				p.file.Meet.Location += ", "
+			}
+			p.file.Meet.Location += nation
+		}
+		p.file.Meet.Course, _ = course(attr("course"))
+		p.course = p.file.Meet.Course
+
+	case "SESSION":
+		p.session.name = attr("name")
+		if p.session.name == "" {
+			p.session.name = "Session " + attr("number")
+		}
+		p.session.date, _ = time.Parse(dateLayout, attr("date"))
+		if !p.session.date.IsZero() && (p.file.Meet.Date.IsZero() || p.session.date.Before(p.file.Meet.Date)) {
+			p.file.Meet.Date = p.session.date
+		}
+		p.course = p.file.Meet.Course
+		if code := attr("course"); code != "" {
+			p.course, _ = course(code)
+		}
+
+	case "EVENT":
+		var e eventXML
+		if err := p.dec.DecodeElement(&e, &t); err != nil {
+			return fmt.Errorf("Invalid LENEX file: %w", err)
+		}
+		p.event(e, line)
+
+	case "CLUB":
+		p.club = attr("name")
+
+	case "ATHLETE":
+		swimmer := athleteSwimmer(attr("firstname"), attr("nameprefix"), attr("lastname"), attr("birthdate"), attr("gender"), attr("license"))
+		swimmer.Club = p.club
+		p.athletes[attr("athleteid")] = swimmer
+		p.athlete = &swimmer
+
+	case "RELAY":
+		p.relay, _ = strconv.Atoi(attr("number"))
+		if p.relay <= 0 {
+			p.relay = 1
+		}
+
+	case "RESULT":
+		var res resultXML
+		if err := p.dec.DecodeElement(&res, &t); err != nil {
+			return fmt.Errorf("Invalid LENEX file: %w", err)
+		}
+		var err error
+		switch {
+		case p.relay > 0:
+			err = p.relayResult(res, line)
+		case p.athlete != nil:
+			err = p.individualResult(res, line)
+		}
+		if err != nil {
+			p.errors = append(p.errors, models.ImportError{Line: line, Message: err.Error()})
+		}
+	}
+	return nil
+}
+
+// event reads an EVENT element into the meet's program
+func (p *parser) event(e eventXML, line int) {
+	style := e.SwimStyle
+	legs := max(style.RelayCount, 1)
+	stroke, ok := strokes[strings.ToUpper(style.Stroke)]
+
+	var problem string
+	switch {
+	case !ok:
+		problem = fmt.Sprintf("stroke %q is not supported", style.Stroke)
+	case style.Distance <= 0:
+		problem = "it has no distance"
+	case p.course == "":
+		problem = "it is not swum in a pool"
+	}
+	if problem != "" {
+		p.skipped[e.EventID] = true
+		p.errors = append(p.errors, models.ImportError{
+			Line:    line,
+			Message: fmt.Sprintf("Event %d skipped with its results: %s", e.Number, problem),
+		})
+		return
+	}
+
+	round, ok := rounds[strings.ToUpper(e.Round)]
+	if !ok {
+		round = models.RoundFinals
+	}
+	date := p.session.date
+	if date.IsZero() {
+		date = p.file.Meet.Date
+	}
+
+	p.events[e.EventID] = event{
+		number:   e.Number,
+		distance: style.Distance,
+		legs:     legs,
+		stroke:   stroke,
+		course:   p.course,
+		round:    round,
+		date:     date,
+	}
+	p.file.Program = append(p.file.Program, models.ImportedMeetEvent{
+		Line:     line,
+		Session:  p.session.name,
+		EventNum: e.Number,
+		Distance: style.Distance * legs,
+		Stroke:   stroke,
+		Legs:     legs,
+		Course:   p.course,
+	})
+}
+
+// resultEvent returns the event of a result. ok is false for results of
+// events that were skipped, which have already been reported.
+func (p *parser) resultEvent(res resultXML) (ev event, ok bool, err error) {
+	if p.skipped[res.EventID] {
+		return event{}, false, nil
+	}
+	ev, ok = p.events[res.EventID]
+	if !ok {
+		return event{}, false, fmt.Errorf("Result for unknown event %q", res.EventID)
+	}
+	return ev, true, nil
+}
+
+// individualResult reads an athlete's RESULT element
+func (p *parser) individualResult(res resultXML, line int) error {
+	ev, ok, err := p.resultEvent(res)
+	if !ok {
+		return err
+	}
+	if ev.legs > 1 {
+		return fmt.Errorf("%s has an individual result in relay event %d", p.athlete.Name, ev.number)
+	}
+
+	timeMs, status, swum, err := result(res)
+	if err != nil || !swum {
+		return err
+	}
+	swim := models.ImportedSwim{
+		Line:     line,
+		Swimmer:  *p.athlete,
+		Distance: ev.distance,
+		Stroke:   ev.stroke,
+		Course:   ev.course,
+		Round:    ev.round,
+		Date:     ev.date,
+		TimeMs:   timeMs,
+		Status:   status,
+	}
+
+	if len(res.Splits) > 0 && timeMs > 0 {
+		swim.SplitType = models.SplitTypeCumulative
+		splits, err := cumulativeSplits(res.Splits)
+		if err != nil {
+			return err
+		}
+		distances := make([]int, 0, len(splits))
+		for distance := range splits {
+			if distance < ev.distance {
+				distances = append(distances, distance)
+			}
+		}
+		sort.Ints(distances)
+		for _, distance := range distances {
+			swim.Splits = append(swim.Splits, models.SplitInput{Distance: distance, TimeMs: splits[distance]})
+		}
+		// LENEX leaves the final split to the swim time
+		swim.Splits = append(swim.Splits, models.SplitInput{Distance: ev.distance, TimeMs: timeMs})
+	}
+
+	p.file.Swims = append(p.file.Swims, swim)
+	return nil
+}
+
+// relayResult reads a relay's RESULT element. Its legs are placed once the
+// whole file has been read.
+func (p *parser) relayResult(res resultXML, line int) error {
+	ev, ok, err := p.resultEvent(res)
+	if !ok {
+		return err
+	}
+	if ev.legs == 1 {
+		return fmt.Errorf("%s relay %d has a result in individual event %d", p.club, p.relay, ev.number)
+	}
+
+	timeMs, status, swum, err := result(res)
+	if err != nil || !swum {
+		return err
+	}
+	splits, err := cumulativeSplits(res.Splits)
+	if err != nil {
+		return err
+	}
+	splits[ev.distance*ev.legs] = timeMs
+
+	p.pending = append(p.pending, pendingRelay{index: len(p.file.Relays), club: p.club, positions: res.Positions, splits: splits})
+	p.file.Relays = append(p.file.Relays, models.ImportedRelay{
+		Line:     line,
+		TeamName: strings.TrimSpace(p.club + " " + relayLetter(p.relay)),
+		Distance: ev.distance * ev.legs,
+		Stroke:   ev.stroke,
+		Course:   ev.course,
+		Round:    ev.round,
+		Date:     ev.date,
+		TimeMs:   timeMs,
+		Status:   status,
+	})
+	return nil
+}
+
+// finishRelays places the swimmers of every relay in swimming order, with
+// their leg times when the relay's splits include every changeover
+func (p *parser) finishRelays() {
+	for _, pending := range p.pending {
+		relay := &p.file.Relays[pending.index]
+		positions := append([]relayPositionXML{}, pending.positions...)
+		sort.Slice(positions, func(i, j int) bool { return positions[i].Number < positions[j].Number })
+
+		legDistance := relay.Distance / max(len(positions), 1)
+		for _, position := range positions {
+			if position.Number <= 0 {
+				continue // Alternate
+			}
+
+			var swimmer models.ImportedSwimmer
+			if a := position.Athlete; a != nil {
+				swimmer = athleteSwimmer(a.FirstName, a.NamePrefix, a.LastName, a.BirthDate, a.Gender, a.License)
+				swimmer.Club = pending.club
+			} else if known, ok := p.athletes[position.AthleteID]; ok {
+				swimmer = known
+			} else {
+				p.errors = append(p.errors, models.ImportError{
+					Line:    relay.Line,
+					Message: fmt.Sprintf("%s leg %d names unknown athlete %q", relay.TeamName, position.Number, position.AthleteID),
+				})
+				continue
+			}
+
+			leg := models.ImportedRelayLeg{Swimmer: swimmer}
+			end, endOK := pending.splits[legDistance*position.Number]
+			start, startOK := pending.splits[legDistance*(position.Number-1)]
+			if position.Number == 1 {
+				start, startOK = 0, true
+			}
+			if endOK && startOK && end > start {
+				split := end - start
+				leg.SplitMs = &split
+			}
+			relay.Legs = append(relay.Legs, leg)
+		}
+	}
+}
+
+// result reads the time and status of a RESULT element. swum is false when
+// the result records nothing, such as a result without a time or status.
+func result(res resultXML) (timeMs int, status string, swum bool, err error) {
+	status, ok := statuses[strings.ToUpper(res.Status)]
+	if !ok {
+		return 0, "", false, fmt.Errorf("Unknown result status %q", res.Status)
+	}
+
+	value := strings.ToUpper(res.SwimTime)
+	if value == "" || value == noTime {
+		return 0, status, status != models.ResultOK, nil
+	}
+	timeMs, err = models.ParseTime(value)
+	if err != nil {
+		return 0, "", false, err
+	}
+	return timeMs, status, true, nil
+}
+
+// cumulativeSplits reads the SPLIT elements of a result by distance
+func cumulativeSplits(splits []splitXML) (map[int]int, error) {
+	times := make(map[int]int, len(splits))
+	for _, split := range splits {
+		if strings.ToUpper(split.SwimTime) == noTime || split.SwimTime == "" {
+			continue
+		}
+		timeMs, err := models.ParseTime(split.SwimTime)
+		if err != nil {
+			return nil, fmt.Errorf("Split at %d: %w", split.Distance, err)
+		}
+		times[split.Distance] = timeMs
+	}
+	return times, nil
+}
+
+// athleteSwimmer builds a swimmer from the attributes of an ATHLETE element
+func athleteSwimmer(first, prefix, last, birthDate, gender, license string) models.ImportedSwimmer {
+	swimmer := models.ImportedSwimmer{
+		Name:  strings.Join(strings.Fields(first+" "+prefix+" "+last), " "),
+		USSID: strings.ToUpper(license),
+	}
+	if dob, err := time.Parse(dateLayout, birthDate); err == nil {
+		swimmer.DateOfBirth = &dob
+	}
+	swimmer.Gender, _ = models.ParseGender(gender)
+	return swimmer
+}
+
+// relayLetter names a club's relays A, B, C and so on by number
+func relayLetter(number int) string {
+	if number < 1 || number > 26 {
+		return strconv.Itoa(number)
+	}
+	return string(rune('A' + number - 1))
+}
@@ -0,0 +1,34 @@
+package lenex
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseTooLarge(t *testing.T) {
+	// A file just over the limit, which zips down to a small archive
+	lef := bytes.Repeat([]byte(" "), maxFileSize+1)
+
+	var lxf bytes.Buffer
+	archive := zip.NewWriter(&lxf)
+	f, err := archive.Create("meet.lef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(lef); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{"lef": lef, "lxf": lxf.Bytes()}
+	for name, data := range files {
+		_, _, err := Parse(bytes.NewReader(data))
+		if err == nil || !strings.Contains(err.Error(), "larger than 50 MB") {
+			t.Errorf("Parse(%s over the limit) = %v, want a too large error", name, err)
+		}
+	}
+}
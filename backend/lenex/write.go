@@ -0,0 +1,379 @@
+package lenex
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// Written into the header of exported files
+const (
+	lenexVersion = "3.0"
+	softwareName = "LapLogger"
+)
+
+// unattachedClub is the club swimmers without one are listed under
+const unattachedClub = "Unattached"
+
+// strokeCodes maps stroke names to LENEX stroke codes
+var strokeCodes = map[string]string{
+	"Freestyle":              "FREE",
+	"Backstroke":             "BACK",
+	"Breaststroke":           "BREAST",
+	"Butterfly":              "FLY",
+	models.RelayStrokeMedley: "MEDLEY",
+}
+
+// roundCodes maps rounds to LENEX round codes
+var roundCodes = map[string]string{
+	models.RoundPrelims:       "PRE",
+	models.RoundQuarterFinals: "QUA",
+	models.RoundSemiFinals:    "SEM",
+	models.RoundSwimOff:       "SOP",
+	models.RoundFinals:        "FIN",
+}
+
+// statusCodes maps result statuses to LENEX result status codes
+var statusCodes = map[string]string{
+	models.ResultOK:      "",
+	models.ResultDQ:      "DSQ",
+	models.ResultDNS:     "DNS",
+	models.ResultDNF:     "DNF",
+	models.ResultScratch: "WDR",
+}
+
+// cityNation splits a "City, NAT" location, the form Parse writes locations in
+var cityNation = regexp.MustCompile(`^(.*),\s*([A-Z]{3})$`)
+
+// Write writes a meet's results as a zipped LENEX (.lxf) file
+func Write(w io.Writer, results *models.ResultsFile) error {
+	archive := zip.NewWriter(w)
+	f, err := archive.Create("meet.lef")
+	if err != nil {
+		return err
+	}
+	if err := WriteXML(f, results); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// WriteXML writes a meet's results as a plain LENEX (.lef) file. The meet's
+// program becomes its sessions and events, with results not on the program
+// listed under extra events after it. Swimmers are listed under their clubs,
+// and relays under the club of their first swimmer.
+func WriteXML(w io.Writer, results *models.ResultsFile) error {
+	b := &builder{
+		date:     results.Meet.Date.Format(dateLayout),
+		sessions: make(map[string]*sessionXML),
+		extra:    make(map[string]*sessionXML),
+		dated:    make(map[*sessionXML]bool),
+		clubs:    make(map[string]*clubXML),
+		athletes: make(map[string]int),
+		relays:   make(map[string]int),
+	}
+
+	meet := meetXML{Name: results.Meet.Name, City: results.Meet.Location, Course: results.Meet.Course}
+	if m := cityNation.FindStringSubmatch(meet.City); m != nil {
+		meet.City, meet.Nation = strings.TrimSpace(m[1]), m[2]
+	}
+
+	for _, me := range results.Program {
+		if err := b.programEvent(me); err != nil {
+			return err
+		}
+	}
+	for _, swim := range results.Swims {
+		if err := b.swim(swim); err != nil {
+			return err
+		}
+	}
+	for _, relay := range results.Relays {
+		if err := b.relay(relay); err != nil {
+			return err
+		}
+	}
+
+	for _, session := range b.order {
+		meet.Sessions = append(meet.Sessions, *session)
+	}
+	for _, name := range b.clubOrder {
+		meet.Clubs = append(meet.Clubs, *b.clubs[name])
+	}
+
+	doc := lenexXML{
+		Version: lenexVersion,
+		Constructor: constructorXML{
+			Name:    softwareName,
+			Version: lenexVersion,
+			Contact: contactXML{Name: softwareName},
+		},
+		Meets: []meetXML{meet},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// builder collects the elements of the file being written
+type builder struct {
+	date     string
+	order    []*sessionXML          // Sessions in the order they are written
+	sessions map[string]*sessionXML // Program sessions by name
+	extra    map[string]*sessionXML // Sessions of results not on the program, by course
+	dated    map[*sessionXML]bool   // Sessions dated by their results rather than the meet
+	events   []eventRef
+	number   int // Highest event number so far
+	results  int
+
+	clubs     map[string]*clubXML
+	clubOrder []string
+	athletes  map[string]int // Index in their club's athletes by swimmerKey
+	relays    map[string]int // Relays numbered so far by club
+}
+
+// eventRef locates an event written to a session
+type eventRef struct {
+	id      string
+	style   swimStyleXML
+	course  string
+	round   string
+	program bool // On the meet's program, rather than added for a result
+	session *sessionXML
+}
+
+// session returns a session to add events to, creating it when needed
+func (b *builder) session(sessions map[string]*sessionXML, key, name, course string) *sessionXML {
+	if s, ok := sessions[key]; ok {
+		return s
+	}
+	s := &sessionXML{Number: len(b.order) + 1, Name: name, Date: b.date, Course: course}
+	sessions[key] = s
+	b.order = append(b.order, s)
+	return s
+}
+
+// addEvent adds an event to a session
+func (b *builder) addEvent(s *sessionXML, number int, style swimStyleXML, course, round string, program bool) eventRef {
+	ref := eventRef{
+		id:      fmt.Sprint(len(b.events) + 1),
+		style:   style,
+		course:  course,
+		round:   round,
+		program: program,
+		session: s,
+	}
+	s.Events = append(s.Events, eventXML{EventID: ref.id, Number: number, Round: round, SwimStyle: style})
+	b.events = append(b.events, ref)
+	b.number = max(b.number, number)
+	return ref
+}
+
+// programEvent writes an event of the meet's program. Sessions named after
+// a round, such as "prelims", are swum in that round; events of other
+// sessions are timed finals.
+func (b *builder) programEvent(me models.ImportedMeetEvent) error {
+	style, err := swimStyle(me.Distance, me.Legs, me.Stroke)
+	if err != nil {
+		return err
+	}
+
+	round := "TIM"
+	for _, r := range models.Rounds {
+		if strings.EqualFold(me.Session, r) {
+			round = roundCodes[r]
+		}
+	}
+
+	s := b.session(b.sessions, me.Session, me.Session, me.Course)
+	b.addEvent(s, me.EventNum, style, me.Course, round, true)
+	return nil
+}
+
+// findEvent returns the event a result was swum in: the program event in
+// the same round if there is one, then any program event, and otherwise a
+// new event in an extra session for the course
+func (b *builder) findEvent(distance, legs int, stroke, course, round string) (eventRef, error) {
+	style, err := swimStyle(distance, legs, stroke)
+	if err != nil {
+		return eventRef{}, err
+	}
+	code := roundCodes[round]
+
+	var sameEvent *eventRef
+	for i, ref := range b.events {
+		if ref.style != style || ref.course != course {
+			continue
+		}
+		if ref.round == code || (ref.round == "TIM" && round == models.RoundFinals) {
+			return ref, nil
+		}
+		if sameEvent == nil && ref.program {
+			sameEvent = &b.events[i]
+		}
+	}
+	if sameEvent != nil {
+		return *sameEvent, nil
+	}
+
+	s := b.session(b.extra, course, "", course)
+	return b.addEvent(s, b.number+1, style, course, code, false), nil
+}
+
+// swim writes an individual result under its swimmer
+func (b *builder) swim(swim models.ImportedSwim) error {
+	ref, err := b.findEvent(swim.Distance, 1, swim.Stroke, swim.Course, swim.Round)
+	if err != nil {
+		return err
+	}
+
+	res := b.result(ref, swim.TimeMs, swim.Status, swim.Date)
+	for _, split := range swim.Splits {
+		// LENEX leaves the final split to the swim time
+		if split.Distance < swim.Distance {
+			res.Splits = append(res.Splits, splitXML{Distance: split.Distance, SwimTime: lenexTime(split.TimeMs)})
+		}
+	}
+
+	athlete := b.athlete(swim.Swimmer)
+	athlete.Results = append(athlete.Results, res)
+	return nil
+}
+
+// relay writes a relay result under the club of its first swimmer
+func (b *builder) relay(relay models.ImportedRelay) error {
+	if len(relay.Legs) == 0 {
+		return fmt.Errorf("%s relay has no swimmers", relay.TeamName)
+	}
+	ref, err := b.findEvent(relay.Distance, len(relay.Legs), relay.Stroke, relay.Course, relay.Round)
+	if err != nil {
+		return err
+	}
+
+	res := b.result(ref, relay.TimeMs, relay.Status, relay.Date)
+	elapsed, complete := 0, true
+	for i, leg := range relay.Legs {
+		athlete := b.athlete(leg.Swimmer)
+		res.Positions = append(res.Positions, relayPositionXML{AthleteID: athlete.AthleteID, Number: i + 1})
+
+		if leg.SplitMs == nil {
+			complete = false
+			continue
+		}
+		elapsed += *leg.SplitMs
+		if i < len(relay.Legs)-1 {
+			res.Splits = append(res.Splits, splitXML{Distance: ref.style.Distance * (i + 1), SwimTime: lenexTime(elapsed)})
+		}
+	}
+	if !complete {
+		res.Splits = nil
+	}
+
+	name := b.club(relay.Legs[0].Swimmer.Club)
+	b.relays[name]++
+	club := b.clubs[name]
+	club.Relays = append(club.Relays, relayXML{Number: b.relays[name], Results: []resultXML{res}})
+	return nil
+}
+
+// result starts a RESULT element. A session is dated by the earliest
+// result swum in it.
+func (b *builder) result(ref eventRef, timeMs int, status string, date time.Time) resultXML {
+	if value := date.Format(dateLayout); !b.dated[ref.session] || value < ref.session.Date {
+		ref.session.Date = value
+		b.dated[ref.session] = true
+	}
+
+	b.results++
+	res := resultXML{
+		ResultID: fmt.Sprint(b.results),
+		EventID:  ref.id,
+		SwimTime: noTime,
+		Status:   statusCodes[status],
+	}
+	if timeMs > 0 {
+		res.SwimTime = lenexTime(timeMs)
+	}
+	return res
+}
+
+// club returns the name a club is written under, adding it when needed
+func (b *builder) club(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = unattachedClub
+	}
+	if _, ok := b.clubs[name]; !ok {
+		b.clubs[name] = &clubXML{Name: name}
+		b.clubOrder = append(b.clubOrder, name)
+	}
+	return name
+}
+
+// athlete returns a swimmer's ATHLETE element, adding it to their club when
+// needed
+func (b *builder) athlete(swimmer models.ImportedSwimmer) *athleteXML {
+	club := b.clubs[b.club(swimmer.Club)]
+	key := swimmerKey(swimmer)
+	if i, ok := b.athletes[key]; ok {
+		return &club.Athletes[i]
+	}
+
+	a := athleteXML{
+		AthleteID: fmt.Sprint(len(b.athletes) + 1),
+		License:   swimmer.USSID,
+	}
+	fields := strings.Fields(swimmer.Name)
+	if n := len(fields); n > 0 {
+		a.FirstName, a.LastName = strings.Join(fields[:n-1], " "), fields[n-1]
+	}
+	if swimmer.DateOfBirth != nil {
+		a.BirthDate = swimmer.DateOfBirth.Format(dateLayout)
+	}
+	if swimmer.Gender == "F" || swimmer.Gender == "M" {
+		a.Gender = swimmer.Gender
+	}
+
+	b.athletes[key] = len(club.Athletes)
+	club.Athletes = append(club.Athletes, a)
+	return &club.Athletes[len(club.Athletes)-1]
+}
+
+// swimmerKey identifies a swimmer among the results being written
+func swimmerKey(s models.ImportedSwimmer) string {
+	dob := ""
+	if s.DateOfBirth != nil {
+		dob = s.DateOfBirth.Format(dateLayout)
+	}
+	return strings.Join([]string{s.Name, s.USSID, dob, s.Gender, s.Club}, "|")
+}
+
+// swimStyle describes an event by its total distance, legs and stroke name
+func swimStyle(distance, legs int, stroke string) (swimStyleXML, error) {
+	code, ok := strokeCodes[stroke]
+	if !ok {
+		return swimStyleXML{}, fmt.Errorf("%s has no LENEX stroke code", stroke)
+	}
+	legs = max(legs, 1)
+	return swimStyleXML{Distance: distance / legs, RelayCount: legs, Stroke: code}, nil
+}
+
+// lenexTime writes a time as LENEX does, as HH:MM:SS.hh
+func lenexTime(timeMs int) string {
+	hundredths := timeMs / 10
+	return fmt.Sprintf("%02d:%02d:%02d.%02d", hundredths/360000, hundredths/6000%60, hundredths/100%60, hundredths%100)
+}
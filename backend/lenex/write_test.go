@@ -0,0 +1,89 @@
+package lenex
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"laplogger/models"
+)
+
+func TestWriteXMLRoundTrip(t *testing.T) {
+	meetDate := time.Date(2026, 10, 4, 0, 0, 0, 0, time.UTC)
+	maryDOB := time.Date(2012, 5, 14, 0, 0, 0, 0, time.UTC)
+	club := "Springfield Sharks"
+	mary := models.ImportedSwimmer{Name: "Mary Ann Smith", USSID: "ABC123", DateOfBirth: &maryDOB, Gender: models.GenderFemale, Club: club}
+	jo := models.ImportedSwimmer{Name: "Jo Doe", Gender: models.GenderFemale, Club: club}
+	kim := models.ImportedSwimmer{Name: "Kim Roe", Gender: models.GenderFemale, Club: club}
+	lee := models.ImportedSwimmer{Name: "Lee Poe", Gender: models.GenderFemale, Club: club}
+	ms := func(value int) *int { return &value }
+
+	written := &models.ResultsFile{
+		Meet: models.ImportedMeet{Name: "Fall Classic", Location: "Springfield, USA", Date: meetDate, Course: models.CourseLCM},
+		Program: []models.ImportedMeetEvent{
+			{Session: "Prelims", EventNum: 1, Distance: 100, Stroke: "Freestyle", Legs: 1, Course: models.CourseLCM},
+			{Session: "Finals", EventNum: 1, Distance: 100, Stroke: "Freestyle", Legs: 1, Course: models.CourseLCM},
+			{Session: "Finals", EventNum: 2, Distance: 400, Stroke: "Freestyle", Legs: 4, Course: models.CourseLCM},
+		},
+		Swims: []models.ImportedSwim{
+			{Swimmer: mary, Distance: 100, Stroke: "Freestyle", Course: models.CourseLCM, Round: models.RoundPrelims,
+				Date: meetDate, TimeMs: 61230, Status: models.ResultOK, SplitType: models.SplitTypeCumulative,
+				Splits: []models.SplitInput{{Distance: 50, TimeMs: 29870}, {Distance: 100, TimeMs: 61230}}},
+			{Swimmer: mary, Distance: 100, Stroke: "Freestyle", Course: models.CourseLCM, Round: models.RoundFinals,
+				Date: meetDate, TimeMs: 60450, Status: models.ResultDQ},
+			// Results off the program are written under an extra event
+			{Swimmer: mary, Distance: 200, Stroke: "Backstroke", Course: models.CourseLCM, Round: models.RoundFinals,
+				Date: meetDate, Status: models.ResultDNS},
+			{Swimmer: jo, Distance: 100, Stroke: "Freestyle", Course: models.CourseLCM, Round: models.RoundPrelims,
+				Date: meetDate, TimeMs: 63010, Status: models.ResultOK},
+		},
+		Relays: []models.ImportedRelay{{
+			TeamName: club + " A", Distance: 400, Stroke: "Freestyle", Course: models.CourseLCM, Round: models.RoundFinals,
+			Date: meetDate, TimeMs: 242500, Status: models.ResultOK,
+			Legs: []models.ImportedRelayLeg{
+				{Swimmer: mary, SplitMs: ms(60100)},
+				{Swimmer: jo, SplitMs: ms(61200)},
+				{Swimmer: kim, SplitMs: ms(60900)},
+				{Swimmer: lee, SplitMs: ms(60300)},
+			},
+		}},
+	}
+
+	var lef bytes.Buffer
+	if err := WriteXML(&lef, written); err != nil {
+		t.Fatal(err)
+	}
+	read, importErrors, err := Parse(&lef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(importErrors) > 0 {
+		t.Fatalf("import errors: %+v", importErrors)
+	}
+
+	if !reflect.DeepEqual(read.Meet, written.Meet) {
+		t.Errorf("meet = %+v, want %+v", read.Meet, written.Meet)
+	}
+
+	// Parse numbers the lines results were read from, which Write has no say in
+	for i := range read.Program {
+		read.Program[i].Line = 0
+	}
+	for i := range read.Swims {
+		read.Swims[i].Line = 0
+	}
+	for i := range read.Relays {
+		read.Relays[i].Line = 0
+	}
+	// The extra event comes back after the program
+	if n := len(written.Program); len(read.Program) != n+1 || !reflect.DeepEqual(read.Program[:n], written.Program) {
+		t.Errorf("program =\n%+v\nwant\n%+v and an extra event", read.Program, written.Program)
+	}
+	if !reflect.DeepEqual(read.Swims, written.Swims) {
+		t.Errorf("swims =\n%+v\nwant\n%+v", read.Swims, written.Swims)
+	}
+	if !reflect.DeepEqual(read.Relays, written.Relays) {
+		t.Errorf("relays =\n%+v\nwant\n%+v", read.Relays, written.Relays)
+	}
+}
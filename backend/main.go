@@ -38,6 +38,13 @@ func main() {
 	authHandler := handlers.NewAuthHandler(db, jwtSecret)
 	swimmerHandler := handlers.NewSwimmerHandler(db)
 	timeHandler := handlers.NewTimeHandler(db)
+	meetHandler := handlers.NewMeetHandler(db)
+	meetEventHandler := handlers.NewMeetEventHandler(db)
+	relayHandler := handlers.NewRelayHandler(db)
+	standardHandler := handlers.NewStandardHandler(db)
+	preferenceHandler := handlers.NewPreferenceHandler(db)
+	importHandler := handlers.NewImportHandler(db)
+	exportHandler := handlers.NewExportHandler(db)
 
 	// Create router
 	r := mux.NewRouter()
@@ -53,24 +60,87 @@ func main() {
 	protected := api.PathPrefix("").Subrouter()
 	protected.Use(middleware.JWTMiddleware(authHandler))
 
+	// Current user route
+	protected.HandleFunc("/auth/me", authHandler.Me).Methods("GET")
+	protected.HandleFunc("/preferences", preferenceHandler.GetPreferences).Methods("GET")
+	protected.HandleFunc("/preferences", preferenceHandler.UpdatePreferences).Methods("PUT")
+
 	// Swimmer routes
 	protected.HandleFunc("/swimmers", swimmerHandler.GetSwimmers).Methods("GET")
 	protected.HandleFunc("/swimmers", swimmerHandler.CreateSwimmer).Methods("POST")
 	protected.HandleFunc("/swimmers/{id}", swimmerHandler.GetSwimmer).Methods("GET")
+	protected.HandleFunc("/swimmers/{id}", swimmerHandler.UpdateSwimmer).Methods("PUT")
+	protected.HandleFunc("/swimmers/{id}", swimmerHandler.PatchSwimmer).Methods("PATCH")
+	protected.HandleFunc("/swimmers/{id}/archive", swimmerHandler.ArchiveSwimmer).Methods("POST")
+	protected.HandleFunc("/swimmers/{id}/unarchive", swimmerHandler.UnarchiveSwimmer).Methods("POST")
+	protected.HandleFunc("/swimmers/{id}/merge", swimmerHandler.MergeSwimmers).Methods("POST")
+	protected.HandleFunc("/swimmers/{id}/personal-bests", timeHandler.GetPersonalBests).Methods("GET")
+	protected.HandleFunc("/swimmers/{id}/progression", timeHandler.GetProgression).Methods("GET")
 
 	// Time routes
 	protected.HandleFunc("/times", timeHandler.CreateTime).Methods("POST")
 	protected.HandleFunc("/times/{swimmer_id}", timeHandler.GetTimesBySwimmer).Methods("GET")
 	protected.HandleFunc("/times", timeHandler.GetAllTimes).Methods("GET")
+	protected.HandleFunc("/times/{id}", timeHandler.UpdateTime).Methods("PUT")
+	protected.HandleFunc("/times/{id}", timeHandler.DeleteTime).Methods("DELETE")
+	protected.HandleFunc("/times/{id}/history", timeHandler.GetTimeHistory).Methods("GET")
+	protected.HandleFunc("/times/{id}/conversions", timeHandler.GetTimeConversions).Methods("GET")
+	protected.HandleFunc("/times/{id}/splits", timeHandler.GetSplits).Methods("GET")
+	protected.HandleFunc("/times/{id}/splits", timeHandler.SetSplits).Methods("PUT")
+	protected.HandleFunc("/times/{id}/splits", timeHandler.DeleteSplits).Methods("DELETE")
+	protected.HandleFunc("/times/{id}/split-analysis", timeHandler.GetSplitAnalysis).Methods("GET")
+
+	// Meet routes
+	protected.HandleFunc("/meets", meetHandler.GetMeets).Methods("GET")
+	protected.HandleFunc("/meets", meetHandler.CreateMeet).Methods("POST")
+	protected.HandleFunc("/meets/{id}", meetHandler.GetMeet).Methods("GET")
+	protected.HandleFunc("/meets/{id}", meetHandler.UpdateMeet).Methods("PUT")
+	protected.HandleFunc("/meets/{id}", meetHandler.DeleteMeet).Methods("DELETE")
+
+	// Meet event (program) routes
+	protected.HandleFunc("/meets/{id}/events", meetEventHandler.GetMeetProgram).Methods("GET")
+	protected.HandleFunc("/meets/{id}/events", meetEventHandler.CreateMeetEvent).Methods("POST")
+	protected.HandleFunc("/meets/{id}/events/order", meetEventHandler.ReorderMeetEvents).Methods("PUT")
+	protected.HandleFunc("/meets/{id}/events/{meet_event_id}", meetEventHandler.DeleteMeetEvent).Methods("DELETE")
+	protected.HandleFunc("/meets/{id}/entries/sdif", meetEventHandler.ExportSDIFEntries).Methods("POST")
+	protected.HandleFunc("/meets/{id}/results/lenex", meetEventHandler.ExportLENEXResults).Methods("GET")
+
+	// Relay routes
+	protected.HandleFunc("/relays", relayHandler.GetRelays).Methods("GET")
+	protected.HandleFunc("/relays", relayHandler.CreateRelay).Methods("POST")
+	protected.HandleFunc("/relays/{id}", relayHandler.GetRelay).Methods("GET")
+	protected.HandleFunc("/relays/{id}", relayHandler.UpdateRelay).Methods("PUT")
+	protected.HandleFunc("/relays/{id}", relayHandler.DeleteRelay).Methods("DELETE")
+
+	// Time standard routes
+	protected.HandleFunc("/standards", standardHandler.GetStandards).Methods("GET")
+	protected.HandleFunc("/standards", standardHandler.CreateStandard).Methods("POST")
+	protected.HandleFunc("/standards/import", standardHandler.ImportStandards).Methods("POST")
+	protected.HandleFunc("/standards/{id}", standardHandler.UpdateStandard).Methods("PUT")
+	protected.HandleFunc("/standards/{id}", standardHandler.DeleteStandard).Methods("DELETE")
+
+	// Import routes
+	protected.HandleFunc("/import/sdif", importHandler.ImportSDIF).Methods("POST")
+	protected.HandleFunc("/import/lenex", importHandler.ImportLENEX).Methods("POST")
+	protected.HandleFunc("/import/swimmers", importHandler.ImportSwimmersCSV).Methods("POST")
+	protected.HandleFunc("/import/times", importHandler.ImportTimesCSV).Methods("POST")
+
+	// Export routes
+	protected.HandleFunc("/export/times", exportHandler.ExportTimes).Methods("GET")
+	protected.HandleFunc("/export/swimmers", exportHandler.ExportSwimmers).Methods("GET")
+
+	// Report routes
+	protected.HandleFunc("/reports/dq", timeHandler.GetDQReport).Methods("GET")
 
 	// Static data routes
 	protected.HandleFunc("/strokes", getStrokes).Methods("GET")
 	protected.HandleFunc("/events", getEvents).Methods("GET")
+	protected.HandleFunc("/dq-codes", getDQCodes).Methods("GET")
 
 	// CORS setup
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"http://localhost:3000"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
 	})
 
@@ -103,15 +173,34 @@ func getStrokes(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(strokes)
 }
 
+// getDQCodes lists the catalogue of disqualification codes
+func getDQCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.Infractions)
+}
+
+// getEvents lists all events. With ?course= only events that can be swum in
+// that course are returned (yards events for SCY, meters events otherwise).
 func getEvents(w http.ResponseWriter, r *http.Request) {
+	units := ""
+	if value := r.URL.Query().Get("course"); value != "" {
+		course, ok := models.ParseCourse(value)
+		if !ok {
+			http.Error(w, "Course must be SCY, SCM or LCM", http.StatusBadRequest)
+			return
+		}
+		units = models.CourseUnits(course)
+	}
+
 	query := `
-		SELECT e.id, e.stroke_id, e.distance, e.name, s.name as stroke_name
+		SELECT e.id, e.stroke_id, e.distance, e.units, e.legs, e.name, s.name as stroke_name
 		FROM events e
 		JOIN strokes s ON e.stroke_id = s.id
-		ORDER BY s.id, e.distance
+		WHERE ? = '' OR e.units = ?
+		ORDER BY e.legs, s.id, e.units, e.distance
 	`
 
-	rows, err := globalDB.Query(query)
+	rows, err := globalDB.Query(query, units, units)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -121,7 +210,7 @@ func getEvents(w http.ResponseWriter, r *http.Request) {
 	var events []models.EventWithDetails
 	for rows.Next() {
 		var event models.EventWithDetails
-		err := rows.Scan(&event.ID, &event.StrokeID, &event.Distance, &event.Name, &event.StrokeName)
+		err := rows.Scan(&event.ID, &event.StrokeID, &event.Distance, &event.Units, &event.Legs, &event.Name, &event.StrokeName)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -2,18 +2,26 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
-	"laplogger/handlers"
+	"github.com/golang-jwt/jwt/v5"
+
+	"laplogger/models"
 )
 
 type contextKey string
 
 const UserContextKey contextKey = "user"
 
+// TokenValidator validates a JWT and returns its claims
+type TokenValidator interface {
+	ValidateToken(tokenString string) (*jwt.MapClaims, error)
+}
+
 // JWTMiddleware validates JWT tokens
-func JWTMiddleware(authHandler *handlers.AuthHandler) func(http.Handler) http.Handler {
+func JWTMiddleware(authHandler TokenValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get token from Authorization header
@@ -37,15 +45,52 @@ func JWTMiddleware(authHandler *handlers.AuthHandler) func(http.Handler) http.Ha
 				return
 			}
 
+			user, err := authUserFromClaims(*claims)
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
 			// Add user info to context
-			ctx := context.WithValue(r.Context(), UserContextKey, *claims)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
 		})
 	}
 }
 
-// GetUserFromContext extracts user information from request context
-func GetUserFromContext(r *http.Request) (map[string]interface{}, bool) {
-	user, ok := r.Context().Value(UserContextKey).(map[string]interface{})
-	return user, ok
+// WithUser returns a copy of ctx carrying the authenticated user
+func WithUser(ctx context.Context, user *models.AuthUser) context.Context {
+	return context.WithValue(ctx, UserContextKey, user)
+}
+
+// GetUserFromContext extracts the authenticated user from request context
+func GetUserFromContext(r *http.Request) (*models.AuthUser, bool) {
+	user, ok := r.Context().Value(UserContextKey).(*models.AuthUser)
+	return user, ok && user != nil
+}
+
+// authUserFromClaims builds the authenticated user from validated JWT claims
+func authUserFromClaims(claims jwt.MapClaims) (*models.AuthUser, error) {
+	// JSON numbers in the token are decoded as float64
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return nil, errors.New("token has no user_id claim")
+	}
+
+	username, _ := claims["username"].(string)
+	user := &models.AuthUser{
+		ID:       int(userID),
+		Username: username,
+		Roles:    []string{},
+	}
+
+	// Tokens issued before roles were introduced carry no roles claim
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if name, ok := role.(string); ok {
+				user.Roles = append(user.Roles, name)
+			}
+		}
+	}
+
+	return user, nil
 }
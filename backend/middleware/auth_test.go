@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"laplogger/handlers"
+	"laplogger/middleware"
+	"laplogger/models"
+)
+
+const testSecret = "test-secret"
+
+// signToken signs claims as the auth handler does for a logged in user
+func signToken(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func userClaims(id int, username string, roles ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id":  id,
+		"username": username,
+		"roles":    roles,
+		"exp":      time.Now().Add(time.Hour).Unix(),
+		"iat":      time.Now().Unix(),
+	}
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	validator := handlers.NewAuthHandler(nil, testSecret)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUser   *models.AuthUser
+	}{
+		{
+			name:       "valid token",
+			header:     "Bearer " + signToken(t, testSecret, userClaims(42, "alice", "coach")),
+			wantStatus: http.StatusOK,
+			wantUser:   &models.AuthUser{ID: 42, Username: "alice", Roles: []string{"coach"}},
+		},
+		{
+			name:       "missing token",
+			header:     "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token signed with another secret",
+			header:     "Bearer " + signToken(t, "other-secret", userClaims(42, "alice", "coach")),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "malformed token",
+			header:     "Bearer not-a-token",
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser *models.AuthUser
+			reached := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				gotUser, _ = middleware.GetUserFromContext(r)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			middleware.JWTMiddleware(validator)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantUser == nil {
+				if reached {
+					t.Fatal("handler was reached without a valid token")
+				}
+				return
+			}
+			if !reflect.DeepEqual(gotUser, tt.wantUser) {
+				t.Errorf("user = %+v, want %+v", gotUser, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestMeThroughRouter(t *testing.T) {
+	authHandler := handlers.NewAuthHandler(nil, testSecret)
+
+	r := mux.NewRouter()
+	protected := r.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.JWTMiddleware(authHandler))
+	protected.HandleFunc("/auth/me", authHandler.Me).Methods("GET")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testSecret, userClaims(7, "bob", "admin")))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var got models.AuthUser
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := models.AuthUser{ID: 7, Username: "bob", Roles: []string{"admin"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("me = %+v, want %+v", got, want)
+	}
+}
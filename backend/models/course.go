@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// Pool courses
+const (
+	CourseSCY = "SCY" // Short course yards (25 yard pool)
+	CourseSCM = "SCM" // Short course meters (25 meter pool)
+	CourseLCM = "LCM" // Long course meters (50 meter pool)
+)
+
+// DefaultCourse is assumed for meter times logged without a course, and for
+// times recorded before courses were tracked
+const DefaultCourse = CourseLCM
+
+// Units that event distances are measured in
+const (
+	UnitsMeters = "meters"
+	UnitsYards  = "yards"
+)
+
+// Courses lists every supported course
+var Courses = []string{CourseSCY, CourseSCM, CourseLCM}
+
+// ParseCourse normalizes a course code such as "scy", reporting whether it is valid
+func ParseCourse(value string) (string, bool) {
+	course := strings.ToUpper(strings.TrimSpace(value))
+	for _, c := range Courses {
+		if course == c {
+			return course, true
+		}
+	}
+	return "", false
+}
+
+// CourseUnits returns the units distances are measured in for a course
+func CourseUnits(course string) string {
+	if course == CourseSCY {
+		return UnitsYards
+	}
+	return UnitsMeters
+}
+
+// UnitsAbbreviation returns the short suffix used in event names, e.g. "m" in "100m Freestyle"
+func UnitsAbbreviation(units string) string {
+	if units == UnitsYards {
+		return "y"
+	}
+	return "m"
+}
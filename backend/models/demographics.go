@@ -0,0 +1,64 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Genders a swimmer competes under
+const (
+	GenderFemale = "F"
+	GenderMale   = "M"
+	GenderMixed  = "X" // Non-binary swimmers and mixed relays
+)
+
+// ParseGender normalizes a gender such as "female" or "f" to its one-letter
+// code, reporting whether it is valid. An empty gender is left empty.
+func ParseGender(value string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "":
+		return "", true
+	case "F", "FEMALE", "GIRLS", "WOMEN":
+		return GenderFemale, true
+	case "M", "MALE", "BOYS", "MEN":
+		return GenderMale, true
+	case "X":
+		return GenderMixed, true
+	}
+	return "", false
+}
+
+// AgeGroups lists the standard age groups from youngest to oldest
+var AgeGroups = []string{"10&U", "11-12", "13-14", "15-16", "17-18", "19&O"}
+
+// AgeOn returns the age in whole years of someone born on dob at date
+func AgeOn(dob, date time.Time) int {
+	age := date.Year() - dob.Year()
+	if date.Month() < dob.Month() || (date.Month() == dob.Month() && date.Day() < dob.Day()) {
+		age--
+	}
+	return age
+}
+
+// AgeGroup returns the standard age group for an age, e.g. "11-12"
+func AgeGroup(age int) string {
+	switch {
+	case age <= 10:
+		return "10&U"
+	case age >= 19:
+		return "19&O"
+	}
+	return AgeGroups[(age-9)/2]
+}
+
+// SetAgeOn fills in the swimmer's age and age group as of a date. USA
+// Swimming uses the swimmer's age on the first day of the meet.
+func (s *Swimmer) SetAgeOn(date time.Time) {
+	s.Age, s.AgeGroup = nil, ""
+	if s.DateOfBirth == nil {
+		return
+	}
+	age := AgeOn(*s.DateOfBirth, date)
+	s.Age = &age
+	s.AgeGroup = AgeGroup(age)
+}
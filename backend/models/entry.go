@@ -0,0 +1,31 @@
+package models
+
+// MeetEntriesRequest chooses the swimmers to enter in a meet
+type MeetEntriesRequest struct {
+	SwimmerIDs []int  `json:"swimmer_ids"`
+	Course     string `json:"course"`    // Course the meet is swum in
+	TeamCode   string `json:"team_code"` // USA Swimming team code, e.g. "ILSSC"
+	TeamName   string `json:"team_name"` // Defaults to the swimmers' club
+	Since      string `json:"since"`     // Start of the qualifying period (YYYY-MM-DD), optional
+}
+
+// MeetEntries is a team's entries in a meet, ready to be written to an
+// interchange file such as SDIF
+type MeetEntries struct {
+	Meet     Meet
+	Course   string
+	TeamCode string
+	TeamName string
+	Entries  []MeetEntry // In program order
+}
+
+// MeetEntry enters a swimmer in one event of a meet's program. Swimmers
+// without a seed time are not entered.
+type MeetEntry struct {
+	Swimmer    Swimmer // Age as of the first day of the meet
+	EventNum   int
+	Distance   int
+	Stroke     string
+	SeedMs     int
+	SeedCourse string // The meet's course unless the swimmer has no time in it
+}
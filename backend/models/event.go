@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// strokeAliases maps the stroke names and abbreviations used in results and
+// standards files to the stroke names in the strokes table
+var strokeAliases = map[string]string{
+	"FREESTYLE": "Freestyle", "FREE": "Freestyle", "FR": "Freestyle", "FS": "Freestyle",
+	"BACKSTROKE": "Backstroke", "BACK": "Backstroke", "BK": "Backstroke",
+	"BREASTSTROKE": "Breaststroke", "BREAST": "Breaststroke", "BR": "Breaststroke",
+	"BUTTERFLY": "Butterfly", "FLY": "Butterfly", "FL": "Butterfly",
+	"INDIVIDUALMEDLEY": "Individual Medley", "IM": "Individual Medley",
+}
+
+// ParseStroke returns the stroke name for a name or abbreviation such as
+// "Free", "BK" or "IM", reporting whether it is known
+func ParseStroke(value string) (string, bool) {
+	stroke, ok := strokeAliases[strings.ToUpper(strings.Join(strings.Fields(value), ""))]
+	return stroke, ok
+}
+
+// ParseEventName reads an individual event name such as "100 Free",
+// "200 IM" or "100y Freestyle" into its distance and stroke name. Units
+// are returned when the distance carries a "y" or "m" suffix and are empty
+// otherwise.
+func ParseEventName(value string) (distance int, units, stroke string, ok bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return 0, "", "", false
+	}
+
+	number := strings.ToLower(fields[0])
+	if rest, found := strings.CutSuffix(number, "y"); found {
+		number, units = rest, UnitsYards
+	} else if rest, found := strings.CutSuffix(number, "m"); found {
+		number, units = rest, UnitsMeters
+	}
+
+	distance, err := strconv.Atoi(number)
+	if err != nil || distance <= 0 {
+		return 0, "", "", false
+	}
+
+	stroke, ok = ParseStroke(strings.Join(fields[1:], ""))
+	if !ok {
+		return 0, "", "", false
+	}
+	return distance, units, stroke, true
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Time notation styles
+const (
+	TimeStyleClock = "clock" // Zero-padded minutes, e.g. "00:28.450" and "01:02.340"
+	TimeStyleSwim  = "swim"  // As swim times are usually written, e.g. "28.45" and "1:02.34"
+)
+
+// Precisions, in decimal places of a second
+const (
+	PrecisionHundredths  = 2
+	PrecisionThousandths = 3
+)
+
+// TimeFormat controls how times are written in formatted_time fields. Times
+// of an hour or more, such as open water swims, always show hours.
+type TimeFormat struct {
+	Style     string `json:"time_format"`
+	Precision int    `json:"time_precision"`
+}
+
+// DefaultTimeFormat is used when neither the request nor the user's
+// preferences choose a format
+var DefaultTimeFormat = TimeFormat{Style: TimeStyleClock, Precision: PrecisionThousandths}
+
+// ParseTimeStyle normalizes a time style, reporting whether it is valid. An
+// empty style is left empty.
+func ParseTimeStyle(value string) (string, bool) {
+	switch style := strings.ToLower(strings.TrimSpace(value)); style {
+	case "", TimeStyleClock, TimeStyleSwim:
+		return style, true
+	}
+	return "", false
+}
+
+// ParsePrecision reads a precision given as 2, 3, "hundredths" or
+// "thousandths", reporting whether it is valid. An empty precision is 0.
+func ParsePrecision(value string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return 0, true
+	case "2", "hundredths":
+		return PrecisionHundredths, true
+	case "3", "thousandths":
+		return PrecisionThousandths, true
+	}
+	return 0, false
+}
+
+// Merge returns the format with any unset fields taken from fallback
+func (f TimeFormat) Merge(fallback TimeFormat) TimeFormat {
+	if f.Style == "" {
+		f.Style = fallback.Style
+	}
+	if f.Precision == 0 {
+		f.Precision = fallback.Precision
+	}
+	return f
+}
+
+// Format writes a time in milliseconds. Hundredths are truncated rather than
+// rounded, as timing systems do.
+func (f TimeFormat) Format(timeMs int) string {
+	f = f.Merge(DefaultTimeFormat)
+
+	fraction := fmt.Sprintf("%03d", timeMs%1000)
+	if f.Precision == PrecisionHundredths {
+		fraction = fraction[:2]
+	}
+
+	totalSeconds := timeMs / 1000
+	hours := totalSeconds / 3600
+	minutes := totalSeconds / 60 % 60
+	seconds := totalSeconds % 60
+
+	switch {
+	case hours > 0:
+		return fmt.Sprintf("%d:%02d:%02d.%s", hours, minutes, seconds, fraction)
+	case f.Style == TimeStyleSwim && minutes > 0:
+		return fmt.Sprintf("%d:%02d.%s", minutes, seconds, fraction)
+	case f.Style == TimeStyleSwim:
+		return strconv.Itoa(seconds) + "." + fraction
+	}
+	return fmt.Sprintf("%02d:%02d.%s", minutes, seconds, fraction)
+}
@@ -0,0 +1,102 @@
+package models
+
+import "testing"
+
+func TestFormatParseRoundTrip(t *testing.T) {
+	formats := []TimeFormat{
+		{Style: TimeStyleClock, Precision: PrecisionThousandths},
+		{Style: TimeStyleSwim, Precision: PrecisionThousandths},
+		{Style: TimeStyleClock, Precision: PrecisionHundredths},
+		{Style: TimeStyleSwim, Precision: PrecisionHundredths},
+	}
+	// Hundredths are written truncated, so those formats only round-trip
+	// times in whole hundredths
+	times := []int{1, 9, 28450, 28455, 59999, 60000, 62340, 62345, 599990, 3599999, 3600000, 3912300, 3912345, 36000010}
+
+	for _, f := range formats {
+		for _, timeMs := range times {
+			if f.Precision == PrecisionHundredths && timeMs%10 != 0 {
+				continue
+			}
+			text := f.Format(timeMs)
+			got, err := ParseTime(text)
+			if err != nil {
+				t.Errorf("%+v: ParseTime(%q) for %d ms: %v", f, text, timeMs, err)
+				continue
+			}
+			if got != timeMs {
+				t.Errorf("%+v: %d ms formats as %q, which parses as %d ms", f, timeMs, text, got)
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		format TimeFormat
+		timeMs int
+		want   string
+	}{
+		{TimeFormat{}, 28450, "00:28.450"},
+		{TimeFormat{Style: TimeStyleSwim}, 28450, "28.450"},
+		{TimeFormat{Style: TimeStyleSwim, Precision: PrecisionHundredths}, 62349, "1:02.34"},
+		{TimeFormat{Precision: PrecisionHundredths}, 62349, "01:02.34"},
+		{TimeFormat{Style: TimeStyleSwim, Precision: PrecisionHundredths}, 3912300, "1:05:12.30"},
+		{TimeFormat{}, 3912345, "1:05:12.345"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.format.Format(tt.timeMs); got != tt.want {
+			t.Errorf("%+v.Format(%d) = %q, want %q", tt.format, tt.timeMs, got, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	valid := []struct {
+		value string
+		want  int
+	}{
+		{"28.45", 28450},
+		{"1:02.34", 62340},
+		{"01:02.345", 62345},
+		{"1:05:12.3", 3912300},
+		{" 59 ", 59000},
+		{"0.01", 10},
+	}
+	for _, tt := range valid {
+		got, err := ParseTime(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseTime(%q) = %d, %v; want %d", tt.value, got, err, tt.want)
+		}
+	}
+
+	invalid := []string{"", "1:5.20", "1:60.00", "12.", "1.2345", "-1.00", "+3.00", "0.00", "1:02:03:04", "1:-2.00", "1:02.+5", "abc"}
+	for _, value := range invalid {
+		if got, err := ParseTime(value); err == nil {
+			t.Errorf("ParseTime(%q) = %d, want an error", value, got)
+		}
+	}
+}
+
+func TestResolveTime(t *testing.T) {
+	tests := []struct {
+		timeMs  int
+		text    string
+		want    int
+		wantErr bool
+	}{
+		{62340, "", 62340, false},
+		{0, "1:02.34", 62340, false},
+		{62340, "1:02.34", 62340, false},
+		{62345, "1:02.34", 0, true},
+		{0, "1:2.34", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveTime(tt.timeMs, tt.text)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ResolveTime(%d, %q) = %d, %v; want %d, error %v", tt.timeMs, tt.text, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
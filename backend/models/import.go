@@ -0,0 +1,151 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ImportError describes a row of an imported file that could not be used
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Rounds a meet swim can be swum in, recorded with imported results
+const (
+	RoundPrelims       = "Prelims"
+	RoundQuarterFinals = "Quarter-finals"
+	RoundSemiFinals    = "Semi-finals"
+	RoundSwimOff       = "Swim-off"
+	RoundFinals        = "Finals"
+)
+
+// Rounds lists every round in the order they are swum
+var Rounds = []string{RoundPrelims, RoundQuarterFinals, RoundSemiFinals, RoundSwimOff, RoundFinals}
+
+// ResultsFile is a meet's results as read from an interchange file such as
+// SDIF or LENEX, before they are matched against the database, or as they
+// are exported
+type ResultsFile struct {
+	Meet    ImportedMeet
+	Program []ImportedMeetEvent // Empty when the file has no program
+	Swims   []ImportedSwim
+	Relays  []ImportedRelay
+}
+
+// ClubResults returns the results file with only the swims of a club's
+// swimmers and the relays any of them swam in. Clubs are compared ignoring
+// case.
+func (f *ResultsFile) ClubResults(club string) *ResultsFile {
+	club = strings.TrimSpace(club)
+	filtered := ResultsFile{Meet: f.Meet, Program: f.Program}
+	for _, swim := range f.Swims {
+		if strings.EqualFold(swim.Swimmer.Club, club) {
+			filtered.Swims = append(filtered.Swims, swim)
+		}
+	}
+	for _, relay := range f.Relays {
+		for _, leg := range relay.Legs {
+			if strings.EqualFold(leg.Swimmer.Club, club) {
+				filtered.Relays = append(filtered.Relays, relay)
+				break
+			}
+		}
+	}
+	return &filtered
+}
+
+type ImportedMeet struct {
+	Name     string
+	Location string
+	Date     time.Time
+	Course   string // Empty when the file doesn't give one
+}
+
+// ImportedMeetEvent is one event of a meet's program
+type ImportedMeetEvent struct {
+	Line     int
+	Session  string
+	EventNum int
+	Distance int // Total distance of all legs
+	Stroke   string
+	Legs     int
+	Course   string
+}
+
+// ImportedSwimmer identifies a swimmer as the results file names them
+type ImportedSwimmer struct {
+	Name        string // "First Last"
+	USSID       string
+	DateOfBirth *time.Time
+	Gender      string
+	Club        string
+}
+
+// ImportedSwim is one individual result
+type ImportedSwim struct {
+	Line      int // Line of the file the result was read from
+	Swimmer   ImportedSwimmer
+	Distance  int
+	Stroke    string // Stroke name as in the strokes table
+	Course    string
+	Round     string
+	Date      time.Time
+	TimeMs    int // 0 when the result has no time
+	Status    string
+	SplitType string
+	Splits    []SplitInput
+}
+
+// ImportedRelay is one relay result with its legs in swimming order
+type ImportedRelay struct {
+	Line     int
+	TeamName string
+	Distance int    // Total distance of all legs
+	Stroke   string // "Freestyle" or RelayStrokeMedley
+	Course   string
+	Round    string
+	Date     time.Time
+	TimeMs   int
+	Status   string
+	Legs     []ImportedRelayLeg
+}
+
+type ImportedRelayLeg struct {
+	Swimmer ImportedSwimmer
+	SplitMs *int
+}
+
+// SwimmerMatch reports how a swimmer named in imported results was matched
+type SwimmerMatch struct {
+	Name      string `json:"name"`
+	USSID     string `json:"uss_id,omitempty"`
+	SwimmerID int    `json:"swimmer_id"` // 0 for swimmers a dry run would create
+	MatchedBy string `json:"matched_by"` // "uss_id", "name_dob", "name" or "created"
+}
+
+// ResultsImportResult reports the outcome of a results import. Nothing is
+// saved on a dry run.
+type ResultsImportResult struct {
+	DryRun         bool           `json:"dry_run"`
+	Meet           Meet           `json:"meet"` // ID is 0 for a meet a dry run would create
+	MeetCreated    bool           `json:"meet_created"`
+	Swimmers       []SwimmerMatch `json:"swimmers"`
+	TimesImported  int            `json:"times_imported"`
+	RelaysImported int            `json:"relays_imported"`
+	EventsAdded    int            `json:"events_added"` // Program events scheduled in the meet
+	Duplicates     int            `json:"duplicates"`   // Results already recorded, which are skipped
+	Skipped        []ImportError  `json:"skipped"`      // Results that could not be imported
+	Warnings       []ImportError  `json:"warnings"`     // Results imported without some of their detail
+}
+
+// CSVImportResult reports the outcome of a swimmers or times CSV import.
+// Nothing is saved on a dry run or when any row has an error.
+type CSVImportResult struct {
+	DryRun        bool              `json:"dry_run"`
+	Columns       map[string]string `json:"columns"` // Header of the column each field was read from
+	Rows          int               `json:"rows"`    // Data rows read, excluding the header
+	Created       int               `json:"created"` // Swimmers or times added, or that would be added
+	Errors        []ImportError     `json:"errors"`
+	UnknownEvents []string          `json:"unknown_events,omitempty"` // Event names with no matching individual event
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,16 +13,49 @@ type User struct {
 	Username     string    `json:"username" db:"username"`
 	Email        string    `json:"email" db:"email"`
 	PasswordHash string    `json:"-" db:"password_hash"` // Don't include in JSON responses
+	Role         string    `json:"role" db:"role"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// User roles
+const (
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+// AuthUser is the authenticated caller of a request, built from the JWT claims
+type AuthUser struct {
+	ID       int      `json:"id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+// HasRole reports whether the user has been granted the given role
+func (u *AuthUser) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // Swimmer represents a swimmer in the system
 type Swimmer struct {
-	ID        int       `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Email     string    `json:"email" db:"email"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID          int        `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Email       string     `json:"email" db:"email"`
+	DateOfBirth *time.Time `json:"date_of_birth" db:"date_of_birth"`
+	Gender      string     `json:"gender" db:"gender"` // "F", "M", "X" or empty when unknown
+	Club        string     `json:"club" db:"club"`
+	USSID       string     `json:"uss_id" db:"uss_id"` // USA Swimming registration ID
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ArchivedAt  *time.Time `json:"archived_at" db:"archived_at"` // Set when the swimmer has left the club
+
+	// Age and age group today, or on the date requested; nil without a date of birth
+	Age      *int   `json:"age"`
+	AgeGroup string `json:"age_group,omitempty"`
 }
 
 // Meet represents a swimming meet/competition (single day)
@@ -37,8 +72,10 @@ type Meet struct {
 type Event struct {
 	ID       int    `json:"id" db:"id"`
 	StrokeID int    `json:"stroke_id" db:"stroke_id"`
-	Distance int    `json:"distance" db:"distance"` // Distance in meters
-	Name     string `json:"name" db:"name"`         // e.g., "50m Freestyle"
+	Distance int    `json:"distance" db:"distance"` // Distance in the event's units
+	Units    string `json:"units" db:"units"`       // "meters" (SCM/LCM) or "yards" (SCY)
+	Legs     int    `json:"legs" db:"legs"`         // 1 for individual events, 4 for relays
+	Name     string `json:"name" db:"name"`         // e.g., "50m Freestyle", "4x100m Medley Relay"
 }
 
 // EventWithDetails includes stroke information for display
@@ -58,8 +95,13 @@ type SwimTime struct {
 	ID         int       `json:"id" db:"id"`
 	SwimmerID  int       `json:"swimmer_id" db:"swimmer_id"`
 	EventID    int       `json:"event_id" db:"event_id"`
-	MeetID     *int      `json:"meet_id" db:"meet_id"` // Optional - can be practice time
-	TimeMs     int       `json:"time_ms" db:"time_ms"` // Time in milliseconds
+	MeetID     *int      `json:"meet_id" db:"meet_id"`       // Optional - can be practice time
+	TimeMs     int       `json:"time_ms" db:"time_ms"`       // Time in milliseconds; 0 for a result without a time
+	Course     string    `json:"course" db:"course"`         // "SCY", "SCM" or "LCM"
+	StartType  string    `json:"start_type" db:"start_type"` // "flat" or "relay"
+	Status     string    `json:"status" db:"status"`         // "ok", "dq", "dns", "dnf" or "scratch"
+	DQCode     string    `json:"dq_code,omitempty" db:"dq_code"`
+	Round      string    `json:"round,omitempty" db:"round"` // Meet round of an imported result, such as "Prelims"
 	Notes      string    `json:"notes" db:"notes"`
 	RecordedAt time.Time `json:"recorded_at" db:"recorded_at"`
 }
@@ -71,8 +113,82 @@ type SwimTimeWithDetails struct {
 	EventName     string  `json:"event_name"`
 	StrokeName    string  `json:"stroke_name"`
 	Distance      int     `json:"distance"`
+	Units         string  `json:"units"`
 	MeetName      *string `json:"meet_name"`
-	FormattedTime string  `json:"formatted_time"`
+	SwimmerGender string  `json:"swimmer_gender"`
+	SwimmerAge    *int    `json:"swimmer_age"` // Age on the meet date, or on the day a practice time was recorded
+	AgeGroup      string  `json:"age_group,omitempty"`
+	FormattedTime string  `json:"formatted_time"` // Empty for a result without a time
+	DQReason      string  `json:"dq_reason,omitempty"`
+	Splits        []Split `json:"splits,omitempty"`
+
+	// Standards places the swim in each standard set with cuts for its event, age group, gender and course
+	Standards []StandardAchievement `json:"standards,omitempty"`
+
+	// Converted is set when a course conversion was requested
+	Converted *TimeConversion `json:"converted,omitempty"`
+}
+
+// TimeConversion is a time converted to the equivalent event in another course
+type TimeConversion struct {
+	Course        string `json:"course"`
+	EventID       int    `json:"event_id"`
+	EventName     string `json:"event_name"`
+	Distance      int    `json:"distance"`
+	Units         string `json:"units"`
+	TimeMs        int    `json:"time_ms"`
+	FormattedTime string `json:"formatted_time"`
+}
+
+// TimeConversionsResponse is a recorded time along with its equivalents in the other courses
+type TimeConversionsResponse struct {
+	Time        SwimTimeWithDetails `json:"time"`
+	Conversions []TimeConversion    `json:"conversions"`
+}
+
+// CreateTimeResponse is a newly logged time along with whether it is the
+// swimmer's new personal best in the event
+type CreateTimeResponse struct {
+	SwimTimeWithDetails
+	IsPersonalBest bool `json:"is_personal_best"`
+	PreviousBestMs *int `json:"previous_best_ms"` // nil on the swimmer's first time in the event
+	ImprovementMs  *int `json:"improvement_ms"`   // Set only when the time is a new personal best
+}
+
+// ProgressionPoint is one time in a swimmer's progression in an event
+type ProgressionPoint struct {
+	SwimTimeWithDetails
+	RunningBestMs    int     `json:"running_best_ms"`    // Fastest time up to and including this one
+	RollingAverageMs int     `json:"rolling_average_ms"` // Average of the times within the window
+	ImprovementPct   float64 `json:"improvement_pct"`    // Percent the best time improved over the window
+}
+
+// ProgressionResponse is the chronological series used for charting improvement
+type ProgressionResponse struct {
+	SwimmerID int                `json:"swimmer_id"`
+	EventID   int                `json:"event_id"`
+	Course    string             `json:"course"` // Empty when times from every course are included
+	Window    string             `json:"window"` // "week", "month" or "season"
+	Points    []ProgressionPoint `json:"points"`
+}
+
+// Audit actions recorded for swim time changes
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// SwimTimeAudit records a single change made to a swim time
+type SwimTimeAudit struct {
+	ID            int       `json:"id" db:"id"`
+	SwimTimeID    int       `json:"swim_time_id" db:"swim_time_id"`
+	Action        string    `json:"action" db:"action"` // "create", "update" or "delete"
+	ChangedBy     int       `json:"changed_by" db:"changed_by"`
+	ChangedByName string    `json:"changed_by_name"`
+	ChangedAt     time.Time `json:"changed_at" db:"changed_at"`
+	OldValue      *SwimTime `json:"old_value" db:"old_value"` // nil for creations
+	NewValue      *SwimTime `json:"new_value" db:"new_value"` // nil for deletions
 }
 
 // MeetEvent represents which events are scheduled for a specific meet
@@ -93,12 +209,36 @@ type MeetEventWithDetails struct {
 	EventName  string    `json:"event_name"`
 	StrokeName string    `json:"stroke_name"`
 	Distance   int       `json:"distance"`
+	Units      string    `json:"units"`
 }
 
 // Request types for API
 type CreateSwimmerRequest struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	DateOfBirth string `json:"date_of_birth"` // YYYY-MM-DD
+	Gender      string `json:"gender"`
+	Club        string `json:"club"`
+	USSID       string `json:"uss_id"`
+}
+
+// UpdateSwimmerRequest is a partial update; nil fields are left unchanged
+type UpdateSwimmerRequest struct {
+	Name        *string `json:"name"`
+	Email       *string `json:"email"`
+	DateOfBirth *string `json:"date_of_birth"` // Empty to clear
+	Gender      *string `json:"gender"`
+	Club        *string `json:"club"`
+	USSID       *string `json:"uss_id"`
+}
+
+type MergeSwimmersRequest struct {
+	DuplicateID int `json:"duplicate_id"` // Swimmer whose times move onto the canonical swimmer
+}
+
+type MergeSwimmersResponse struct {
+	Swimmer    Swimmer `json:"swimmer"`
+	MovedTimes int     `json:"moved_times"`
 }
 
 type CreateMeetRequest struct {
@@ -109,16 +249,27 @@ type CreateMeetRequest struct {
 }
 
 type CreateEventRequest struct {
-	StrokeID int `json:"stroke_id"`
-	Distance int `json:"distance"`
+	StrokeID int    `json:"stroke_id"`
+	Distance int    `json:"distance"`
+	Units    string `json:"units"`
+	Legs     int    `json:"legs"`
 }
 
 type CreateTimeRequest struct {
 	SwimmerID int    `json:"swimmer_id"`
 	EventID   int    `json:"event_id"`
-	MeetID    *int   `json:"meet_id"` // Optional
-	TimeMs    int    `json:"time_ms"`
+	MeetID    *int   `json:"meet_id"`    // Optional
+	TimeMs    int    `json:"time_ms"`    // Required for ok results, optional for DQs, omitted otherwise
+	Time      string `json:"time"`       // Alternative to TimeMs, e.g. "1:02.34"
+	Course    string `json:"course"`     // Optional for meter events, defaults to LCM
+	StartType string `json:"start_type"` // Optional, defaults to flat; relay starts don't count toward PBs
+	Status    string `json:"status"`     // Optional, defaults to ok
+	DQCode    string `json:"dq_code"`    // Required for DQs, from the infraction catalogue
 	Notes     string `json:"notes"`
+
+	// Optional splits; the final split must equal TimeMs
+	SplitType string       `json:"split_type"` // "cumulative" (default) or "lap"
+	Splits    []SplitInput `json:"splits"`
 }
 
 type CreateMeetEventRequest struct {
@@ -128,19 +279,91 @@ type CreateMeetEventRequest struct {
 	EventNum int    `json:"event_num"`
 }
 
-// FormatTime converts milliseconds to MM:SS.MS format
+type ReorderMeetEventsRequest struct {
+	Session      string `json:"session"`
+	MeetEventIDs []int  `json:"meet_event_ids"` // Meet event IDs in their new order
+}
+
+// FormatTime writes the time in the default format, e.g. "01:02.340"
 func (st *SwimTime) FormatTime() string {
-	totalSeconds := st.TimeMs / 1000
-	minutes := totalSeconds / 60
-	seconds := totalSeconds % 60
-	milliseconds := st.TimeMs % 1000
+	return DefaultTimeFormat.Format(st.TimeMs)
+}
+
+// ParseTime reads a swim time such as "28.45", "1:02.34", "01:02.345" or
+// "1:05:12.3" into milliseconds, accepting anything the time formats write.
+// The fraction may give tenths, hundredths or thousandths of a second.
+func ParseTime(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("Invalid time %q: expected SS.hh, M:SS.hh or H:MM:SS.hh", value)
+	}
+
+	wholePart, fraction, hasFraction := strings.Cut(parts[len(parts)-1], ".")
+	parts[len(parts)-1] = wholePart
+
+	// Hours and minutes, then seconds; every part after the first is two digits
+	total := 0
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.ContainsAny(part, "+-") {
+			return 0, fmt.Errorf("Invalid time %q: expected SS.hh, M:SS.hh or H:MM:SS.hh", value)
+		}
+		if i > 0 && (len(part) != 2 || n >= 60) {
+			return 0, fmt.Errorf("Invalid time %q: minutes and seconds must be two digits from 00 to 59", value)
+		}
+		total = total*60 + n
+	}
+	total *= 1000
+
+	if hasFraction {
+		if len(fraction) == 0 || len(fraction) > 3 {
+			return 0, fmt.Errorf("Invalid time %q: give tenths, hundredths or thousandths of a second", value)
+		}
+		f, err := strconv.Atoi(fraction)
+		if err != nil || strings.ContainsAny(fraction, "+-") {
+			return 0, fmt.Errorf("Invalid time %q: fraction of a second must be digits", value)
+		}
+		for i := len(fraction); i < 3; i++ {
+			f *= 10
+		}
+		total += f
+	}
+
+	if total <= 0 {
+		return 0, fmt.Errorf("Invalid time %q: time must be greater than zero", value)
+	}
+	return total, nil
+}
+
+// ResolveTime returns the time of a request that may give it in
+// milliseconds, as a formatted string such as "1:02.34", or both. When both
+// are given they must agree.
+func ResolveTime(timeMs int, text string) (int, error) {
+	if strings.TrimSpace(text) == "" {
+		return timeMs, nil
+	}
 
-	return fmt.Sprintf("%02d:%02d.%03d", minutes, seconds, milliseconds)
+	parsed, err := ParseTime(text)
+	if err != nil {
+		return 0, err
+	}
+	if timeMs != 0 && timeMs != parsed {
+		return 0, fmt.Errorf("Time %q does not match time_ms %d", text, timeMs)
+	}
+	return parsed, nil
 }
 
-// GenerateEventName creates a descriptive name for an event
+// GenerateEventName creates a descriptive name for an event. Relay names
+// give the leg distance, e.g. "4x50m Freestyle Relay".
 func (e *Event) GenerateEventName(strokeName string) string {
-	return fmt.Sprintf("%dm %s", e.Distance, strokeName)
+	if e.Legs > 1 {
+		if strokeName == RelayStrokeMedley {
+			strokeName = "Medley"
+		}
+		return fmt.Sprintf("%dx%d%s %s Relay", e.Legs, e.Distance/e.Legs, UnitsAbbreviation(e.Units), strokeName)
+	}
+	return fmt.Sprintf("%d%s %s", e.Distance, UnitsAbbreviation(e.Units), strokeName)
 }
 
 // Authentication request/response types
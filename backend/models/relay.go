@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// Start types. Only flat-start swims count toward personal bests; a relay
+// takeover start is faster than a start from the blocks.
+const (
+	StartFlat  = "flat"
+	StartRelay = "relay"
+)
+
+// RelayStrokeMedley is the stroke medley relay events are stored under
+const RelayStrokeMedley = "Individual Medley"
+
+// medleyRelayOrder is the stroke swum on each leg of a medley relay, which
+// differs from the individual medley order
+var medleyRelayOrder = []string{"Backstroke", "Breaststroke", "Butterfly", "Freestyle"}
+
+// RelayTime represents a recorded relay swim
+type RelayTime struct {
+	ID         int       `json:"id" db:"id"`
+	EventID    int       `json:"event_id" db:"event_id"`
+	MeetID     *int      `json:"meet_id" db:"meet_id"` // Optional - can be practice time
+	TeamName   string    `json:"team_name" db:"team_name"`
+	TimeMs     int       `json:"time_ms" db:"time_ms"`       // Time in milliseconds
+	Course     string    `json:"course" db:"course"`         // "SCY", "SCM" or "LCM"
+	Round      string    `json:"round,omitempty" db:"round"` // Meet round of an imported result, such as "Prelims"
+	Notes      string    `json:"notes" db:"notes"`
+	RecordedAt time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// RelayLeg is one swimmer's leg of a relay
+type RelayLeg struct {
+	ID          int    `json:"id" db:"id"`
+	RelayTimeID int    `json:"relay_time_id" db:"relay_time_id"`
+	LegNum      int    `json:"leg_num" db:"leg_num"`
+	SwimmerID   int    `json:"swimmer_id" db:"swimmer_id"`
+	SwimmerName string `json:"swimmer_name"`
+	StrokeName  string `json:"stroke_name"`            // Stroke swum on this leg
+	SplitMs     *int   `json:"split_ms" db:"split_ms"` // Leg time; nil when not recorded
+	StartType   string `json:"start_type"`             // "flat" for the lead-off leg, otherwise "relay"
+}
+
+// RelayTimeWithDetails includes event, meet and leg information for display
+type RelayTimeWithDetails struct {
+	RelayTime
+	EventName     string     `json:"event_name"`
+	StrokeName    string     `json:"stroke_name"`
+	Distance      int        `json:"distance"`
+	Units         string     `json:"units"`
+	MeetName      *string    `json:"meet_name"`
+	FormattedTime string     `json:"formatted_time"`
+	Legs          []RelayLeg `json:"legs"`
+}
+
+// RelayLegInput is a leg as sent by clients, in swimming order
+type RelayLegInput struct {
+	SwimmerID int  `json:"swimmer_id"`
+	SplitMs   *int `json:"split_ms"` // Optional, but all or no legs must have one
+}
+
+type CreateRelayRequest struct {
+	EventID  int             `json:"event_id"`
+	MeetID   *int            `json:"meet_id"` // Optional
+	TeamName string          `json:"team_name"`
+	TimeMs   int             `json:"time_ms"`
+	Time     string          `json:"time"`   // Alternative to TimeMs, e.g. "1:52.08"
+	Course   string          `json:"course"` // Optional for meter events, defaults to LCM
+	Notes    string          `json:"notes"`
+	Legs     []RelayLegInput `json:"legs"`
+}
+
+// RelayLegStroke returns the stroke swum on a leg (numbered from 1) of a
+// relay event in the given stroke
+func RelayLegStroke(strokeName string, legNum int) string {
+	if strokeName == RelayStrokeMedley && legNum >= 1 && legNum <= len(medleyRelayOrder) {
+		return medleyRelayOrder[legNum-1]
+	}
+	return strokeName
+}
+
+// RelayLegStartType returns how a leg (numbered from 1) is started
+func RelayLegStartType(legNum int) string {
+	if legNum == 1 {
+		return StartFlat
+	}
+	return StartRelay
+}
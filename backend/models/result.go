@@ -0,0 +1,100 @@
+package models
+
+import "strings"
+
+// Result statuses for a swim. Only ok results count toward personal bests
+// and rankings.
+const (
+	ResultOK      = "ok"      // Finished with a valid time
+	ResultDQ      = "dq"      // Disqualified; the time, if any, does not count
+	ResultDNS     = "dns"     // Did not start
+	ResultDNF     = "dnf"     // Started but did not finish
+	ResultScratch = "scratch" // Withdrawn from the event before the start
+)
+
+// ResultStatuses lists every result status
+var ResultStatuses = []string{ResultOK, ResultDQ, ResultDNS, ResultDNF, ResultScratch}
+
+// ParseResultStatus normalizes a result status such as "DQ", reporting
+// whether it is valid. An empty status is ok.
+func ParseResultStatus(value string) (string, bool) {
+	status := strings.ToLower(strings.TrimSpace(value))
+	if status == "" {
+		return ResultOK, true
+	}
+	for _, s := range ResultStatuses {
+		if status == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// Infraction is a reason a swim can be disqualified
+type Infraction struct {
+	Code        string `json:"code"`
+	Category    string `json:"category"` // "General" or the stroke the rule applies to
+	Description string `json:"description"`
+}
+
+// Infractions is the catalogue of disqualification codes
+var Infractions = []Infraction{
+	{"G1", "General", "False start"},
+	{"G2", "General", "Delay of meet"},
+	{"G3", "General", "Walked on or pushed off the bottom"},
+	{"G4", "General", "Pulled on the lane rope"},
+	{"G5", "General", "Interfered with another swimmer"},
+	{"G6", "General", "Did not finish in the same lane"},
+	{"G7", "General", "Unsportsmanlike conduct"},
+	{"FR1", "Freestyle", "Did not touch the wall on a turn"},
+	{"FR2", "Freestyle", "Submerged more than 15m after the start or a turn"},
+	{"BK1", "Backstroke", "Not on the back off the wall"},
+	{"BK2", "Backstroke", "Past vertical toward the breast, not a continuous turn"},
+	{"BK3", "Backstroke", "Submerged more than 15m after the start or a turn"},
+	{"BK4", "Backstroke", "Not on the back at the finish"},
+	{"BK5", "Backstroke", "Toes over the lip of the gutter at the start"},
+	{"BR1", "Breaststroke", "Alternating kick"},
+	{"BR2", "Breaststroke", "Non-simultaneous or one-hand touch"},
+	{"BR3", "Breaststroke", "Hands brought back beyond the hip line"},
+	{"BR4", "Breaststroke", "More than one butterfly kick on the pullout"},
+	{"BR5", "Breaststroke", "Head did not break the surface during a cycle"},
+	{"BR6", "Breaststroke", "Downward butterfly kick during the stroke"},
+	{"FL1", "Butterfly", "Alternating kick"},
+	{"FL2", "Butterfly", "Non-simultaneous or one-hand touch"},
+	{"FL3", "Butterfly", "Arms recovered underwater"},
+	{"FL4", "Butterfly", "Non-simultaneous arm movement"},
+	{"FL5", "Butterfly", "Breaststroke kick"},
+	{"FL6", "Butterfly", "Submerged more than 15m after the start or a turn"},
+	{"IM1", "Individual Medley", "Strokes swum out of sequence"},
+	{"IM2", "Individual Medley", "Freestyle leg swum as another medley stroke"},
+}
+
+// LookupInfraction finds a disqualification code in the catalogue, ignoring case
+func LookupInfraction(code string) (Infraction, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, infraction := range Infractions {
+		if infraction.Code == code {
+			return infraction, true
+		}
+	}
+	return Infraction{}, false
+}
+
+// InfractionCount is how often a swimmer was disqualified for one infraction
+type InfractionCount struct {
+	Infraction
+	Count int `json:"count"`
+}
+
+// DQReportEntry summarizes one swimmer's results and disqualifications
+type DQReportEntry struct {
+	SwimmerID   int               `json:"swimmer_id"`
+	SwimmerName string            `json:"swimmer_name"`
+	Started     int               `json:"started"` // Swims with an ok, DQ or DNF result
+	DQCount     int               `json:"dq_count"`
+	DNFCount    int               `json:"dnf_count"`
+	DNSCount    int               `json:"dns_count"`
+	Scratches   int               `json:"scratches"`
+	DQPct       float64           `json:"dq_pct"` // Disqualifications as a percentage of started swims
+	Infractions []InfractionCount `json:"infractions"`
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Split types accepted when recording splits
+const (
+	SplitTypeCumulative = "cumulative" // Each split is the elapsed time from the start
+	SplitTypeLap        = "lap"        // Each split is the time for that lap only
+)
+
+// Split is an intermediate time within a swim
+type Split struct {
+	ID           int `json:"id" db:"id"`
+	SwimTimeID   int `json:"swim_time_id" db:"swim_time_id"`
+	SplitNum     int `json:"split_num" db:"split_num"`   // 1-based position within the swim
+	Distance     int `json:"distance" db:"distance"`     // Cumulative distance at the split, in the event's units
+	CumulativeMs int `json:"cumulative_ms" db:"time_ms"` // Elapsed time at the split
+	LapMs        int `json:"lap_ms"`                     // Time since the previous split
+}
+
+// SplitInput is a split as sent by clients
+type SplitInput struct {
+	Distance int    `json:"distance"` // Optional; splits are evenly spaced when omitted
+	TimeMs   int    `json:"time_ms"`
+	Time     string `json:"time"` // Alternative to TimeMs, e.g. "32.10"
+}
+
+type SetSplitsRequest struct {
+	SplitType string       `json:"split_type"` // "cumulative" (default) or "lap"
+	Splits    []SplitInput `json:"splits"`
+}
+
+// LapAnalysis is the pacing breakdown of a single split
+type LapAnalysis struct {
+	SplitNum       int  `json:"split_num"`
+	Distance       int  `json:"distance"`
+	LapMs          int  `json:"lap_ms"`
+	CumulativeMs   int  `json:"cumulative_ms"`
+	DeltaMs        *int `json:"delta_ms"`         // Lap time change from the previous lap; nil for the first lap
+	PBCumulativeMs *int `json:"pb_cumulative_ms"` // Elapsed time at this distance in the PB swim
+	VsPBMs         *int `json:"vs_pb_ms"`         // Ahead (negative) or behind (positive) the PB swim
+}
+
+// SplitAnalysis is a pacing report for a swim with splits
+type SplitAnalysis struct {
+	TimeID          int           `json:"time_id"`
+	TimeMs          int           `json:"time_ms"`
+	FormattedTime   string        `json:"formatted_time"`
+	Laps            []LapAnalysis `json:"laps"`
+	FrontHalfMs     int           `json:"front_half_ms"`
+	BackHalfMs      int           `json:"back_half_ms"`
+	DifferentialMs  int           `json:"differential_ms"` // Back half minus front half
+	NegativeSplit   bool          `json:"negative_split"`
+	FadePct         float64       `json:"fade_pct"`   // Percent the back half is slower than the front half
+	PBTimeID        *int          `json:"pb_time_id"` // Swim compared against; nil when there is none
+	PBTimeMs        *int          `json:"pb_time_ms"`
+	PBFormattedTime string        `json:"pb_formatted_time,omitempty"`
+}
+
+// BuildSplits validates split input for a swim over eventDistance finishing
+// in timeMs and returns the ordered splits. Distances must either all be
+// given or all be omitted, must increase and must end at the event distance.
+// The final cumulative split must equal timeMs.
+func BuildSplits(splitType string, inputs []SplitInput, eventDistance, timeMs int) ([]Split, error) {
+	if splitType == "" {
+		splitType = SplitTypeCumulative
+	}
+	if splitType != SplitTypeCumulative && splitType != SplitTypeLap {
+		return nil, errors.New("Split type must be cumulative or lap")
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("At least one split is required")
+	}
+
+	withDistance := 0
+	for _, input := range inputs {
+		if input.Distance != 0 {
+			withDistance++
+		}
+	}
+	if withDistance != 0 && withDistance != len(inputs) {
+		return nil, errors.New("Split distances must be given for every split or for none")
+	}
+	if withDistance == 0 && eventDistance%len(inputs) != 0 {
+		return nil, fmt.Errorf("%d splits do not divide the %d event distance evenly", len(inputs), eventDistance)
+	}
+
+	splits := make([]Split, len(inputs))
+	elapsed, previousDistance := 0, 0
+	for i, input := range inputs {
+		splitMs, err := ResolveTime(input.TimeMs, input.Time)
+		if err != nil {
+			return nil, fmt.Errorf("Split %d: %w", i+1, err)
+		}
+		input.TimeMs = splitMs
+		if input.TimeMs <= 0 {
+			return nil, fmt.Errorf("Split %d must have a positive time", i+1)
+		}
+
+		distance := input.Distance
+		if withDistance == 0 {
+			distance = eventDistance / len(inputs) * (i + 1)
+		}
+		if distance <= previousDistance {
+			return nil, fmt.Errorf("Split %d distance must be greater than the previous split", i+1)
+		}
+
+		lap := input.TimeMs
+		if splitType == SplitTypeCumulative {
+			lap = input.TimeMs - elapsed
+			if lap <= 0 {
+				return nil, fmt.Errorf("Split %d must be later than the previous split", i+1)
+			}
+		}
+		elapsed += lap
+
+		splits[i] = Split{
+			SplitNum:     i + 1,
+			Distance:     distance,
+			CumulativeMs: elapsed,
+			LapMs:        lap,
+		}
+		previousDistance = distance
+	}
+
+	if previousDistance != eventDistance {
+		return nil, fmt.Errorf("Final split distance must equal the event distance of %d", eventDistance)
+	}
+	if elapsed != timeMs {
+		return nil, fmt.Errorf("Final split of %d ms must equal the time of %d ms", elapsed, timeMs)
+	}
+
+	return splits, nil
+}
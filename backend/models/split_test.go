@@ -0,0 +1,81 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSplits(t *testing.T) {
+	tests := []struct {
+		name      string
+		splitType string
+		inputs    []SplitInput
+		distance  int
+		timeMs    int
+		want      []Split
+		wantErr   bool
+	}{
+		{
+			name:     "cumulative time strings",
+			inputs:   []SplitInput{{Time: "30.12"}, {Time: "1:02.34"}},
+			distance: 100,
+			timeMs:   62340,
+			want: []Split{
+				{SplitNum: 1, Distance: 50, CumulativeMs: 30120, LapMs: 30120},
+				{SplitNum: 2, Distance: 100, CumulativeMs: 62340, LapMs: 32220},
+			},
+		},
+		{
+			name:      "lap time strings",
+			splitType: SplitTypeLap,
+			inputs:    []SplitInput{{Distance: 50, Time: "30.12"}, {Distance: 100, Time: "32.22"}},
+			distance:  100,
+			timeMs:    62340,
+			want: []Split{
+				{SplitNum: 1, Distance: 50, CumulativeMs: 30120, LapMs: 30120},
+				{SplitNum: 2, Distance: 100, CumulativeMs: 62340, LapMs: 32220},
+			},
+		},
+		{
+			// The final split must still end at the swim's time, not at
+			// the last time string read
+			name:     "time strings ending before the swim time",
+			inputs:   []SplitInput{{Time: "30.12"}, {Time: "1:02.30"}},
+			distance: 100,
+			timeMs:   62340,
+			wantErr:  true,
+		},
+		{
+			name:     "time string disagreeing with time_ms",
+			inputs:   []SplitInput{{TimeMs: 30000, Time: "30.12"}, {Time: "1:02.34"}},
+			distance: 100,
+			timeMs:   62340,
+			wantErr:  true,
+		},
+		{
+			name:     "malformed time string",
+			inputs:   []SplitInput{{Time: "30.1234"}, {Time: "1:02.34"}},
+			distance: 100,
+			timeMs:   62340,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildSplits(tt.splitType, tt.inputs, tt.distance, tt.timeMs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("BuildSplits = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildSplits = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
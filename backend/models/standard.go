@@ -0,0 +1,137 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AgeGroupOpen is the age group of standards that apply at any age
+const AgeGroupOpen = "OPEN"
+
+// TimeStandard is one cut of a time standard set, such as the 11-12 girls
+// 100 SCY Freestyle "A" time
+type TimeStandard struct {
+	ID            int       `json:"id" db:"id"`
+	StandardSet   string    `json:"standard_set" db:"standard_set"` // e.g. "Motivational 2024-2028", "State"
+	CutName       string    `json:"cut_name" db:"cut_name"`         // e.g. "B", "AAAA", "Sectional"
+	AgeGroup      string    `json:"age_group" db:"age_group"`       // e.g. "10&U", "11-12", "15-18", "OPEN"
+	Gender        string    `json:"gender" db:"gender"`
+	Course        string    `json:"course" db:"course"`
+	EventID       int       `json:"event_id" db:"event_id"`
+	EventName     string    `json:"event_name"`
+	TimeMs        int       `json:"time_ms" db:"time_ms"`
+	FormattedTime string    `json:"formatted_time"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// StandardAchievement places a time among the cuts of one standard set for
+// its event, age group, gender and course
+type StandardAchievement struct {
+	StandardSet string        `json:"standard_set"`
+	Achieved    *TimeStandard `json:"achieved"` // Fastest cut the time makes; nil when it makes none
+	Next        *TimeStandard `json:"next"`     // Next faster cut; nil when the fastest cut is made
+	GapMs       *int          `json:"gap_ms"`   // Time still to drop to make the next cut
+}
+
+type CreateStandardRequest struct {
+	StandardSet string `json:"standard_set"`
+	CutName     string `json:"cut_name"`
+	AgeGroup    string `json:"age_group"`
+	Gender      string `json:"gender"`
+	Course      string `json:"course"`
+	EventID     int    `json:"event_id"`
+	TimeMs      int    `json:"time_ms"`
+	Time        string `json:"time"` // Alternative to TimeMs, e.g. "1:02.39"
+}
+
+// AgeRange is the range of ages an age group covers. A Max of 0 means no
+// upper limit.
+type AgeRange struct {
+	Label string
+	Min   int
+	Max   int
+}
+
+// ParseAgeGroup reads an age group label such as "10&U", "11-12", "19&O",
+// "13 & over", "9" or "Open", reporting whether it is valid. The label is
+// normalized to upper case without spaces.
+func ParseAgeGroup(value string) (AgeRange, bool) {
+	label := strings.ToUpper(strings.Join(strings.Fields(value), ""))
+	switch label {
+	case "":
+		return AgeRange{}, false
+	case AgeGroupOpen, "SENIOR":
+		return AgeRange{Label: AgeGroupOpen}, true
+	}
+
+	for _, suffix := range []string{"&UNDER", "&U"} {
+		if rest, found := strings.CutSuffix(label, suffix); found {
+			age, ok := parseAge(rest)
+			return AgeRange{Label: strconv.Itoa(age) + "&U", Max: age}, ok
+		}
+	}
+	for _, suffix := range []string{"&OVER", "&O"} {
+		if rest, found := strings.CutSuffix(label, suffix); found {
+			age, ok := parseAge(rest)
+			return AgeRange{Label: strconv.Itoa(age) + "&O", Min: age}, ok
+		}
+	}
+
+	if low, high, found := strings.Cut(label, "-"); found {
+		minAge, okMin := parseAge(low)
+		maxAge, okMax := parseAge(high)
+		if !okMin || !okMax || minAge > maxAge {
+			return AgeRange{}, false
+		}
+		return AgeRange{Label: strconv.Itoa(minAge) + "-" + strconv.Itoa(maxAge), Min: minAge, Max: maxAge}, true
+	}
+
+	age, ok := parseAge(label)
+	if !ok {
+		return AgeRange{}, false
+	}
+	return AgeRange{Label: strconv.Itoa(age), Min: age, Max: age}, true
+}
+
+// Contains reports whether an age falls in the range. Only open ranges
+// contain an unknown age.
+func (r AgeRange) Contains(age *int) bool {
+	if r.Min == 0 && r.Max == 0 {
+		return true
+	}
+	if age == nil {
+		return false
+	}
+	return *age >= r.Min && (r.Max == 0 || *age <= r.Max)
+}
+
+// Narrower reports whether the range covers fewer ages than other, so an
+// 11 year old is placed against "11-12" cuts rather than "OPEN" ones
+func (r AgeRange) Narrower(other AgeRange) bool {
+	switch {
+	case r.Max != 0 && other.Max != 0:
+		return r.Max-r.Min < other.Max-other.Min
+	case r.Max != 0 || other.Max != 0:
+		return r.Max != 0
+	}
+	return r.Min > other.Min
+}
+
+// parseAge reads a positive whole-number age
+func parseAge(value string) (int, bool) {
+	age, err := strconv.Atoi(value)
+	return age, err == nil && age > 0
+}
+
+// StandardImportResult reports the outcome of a standards CSV import. Nothing
+// is saved on a dry run or when any row has an error.
+type StandardImportResult struct {
+	StandardSet   string        `json:"standard_set"`
+	DryRun        bool          `json:"dry_run"`
+	Rows          int           `json:"rows"`    // Data rows read, excluding the header
+	Created       int           `json:"created"` // Cuts added to the set
+	Updated       int           `json:"updated"` // Existing cuts given a new time
+	Errors        []ImportError `json:"errors"`
+	UnknownEvents []string      `json:"unknown_events"` // Event names with no matching individual event
+}
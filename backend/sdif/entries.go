@@ -0,0 +1,186 @@
+package sdif
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// recordLength is the width of every SDIF record
+const recordLength = 160
+
+// Codes written to the header records of entry files
+const (
+	orgUSS       = "1"  // Organization code for USA Swimming
+	fileEntries  = "01" // File code for meet registrations
+	sdifVersion  = "V3"
+	softwareName = "LapLogger"
+	eventAgeOpen = "UNOV" // Event age code for an open (all ages) event
+)
+
+// maxSeedMs is the longest time the 8 column time fields hold, 99:59.99
+const maxSeedMs = 100*60*1000 - 1
+
+// strokeCodes maps individual stroke names to SDIF stroke codes
+var strokeCodes = map[string]string{
+	"Freestyle":         "1",
+	"Backstroke":        "2",
+	"Breaststroke":      "3",
+	"Butterfly":         "4",
+	"Individual Medley": "5",
+}
+
+// courseCodes maps courses to SDIF course codes
+var courseCodes = map[string]string{
+	models.CourseSCM: "S",
+	models.CourseSCY: "Y",
+	models.CourseLCM: "L",
+}
+
+// now returns the creation date written to file headers
+var now = time.Now
+
+// cityState splits a "City, ST" location, the form Parse writes locations in
+var cityState = regexp.MustCompile(`^(.*),\s*([A-Za-z]{2})$`)
+
+// record is one SDIF record being written
+type record []byte
+
+func newRecord(code string) record {
+	r := record(strings.Repeat(" ", recordLength))
+	copy(r, code)
+	return r
+}
+
+// set writes value left-justified into columns start to end, cutting it
+// short when it is too long
+func (r record) set(start, end int, value string) {
+	width := end - start + 1
+	if len(value) > width {
+		value = value[:width]
+	}
+	copy(r[start-1:end], value)
+}
+
+// setRight writes value right-justified into columns start to end
+func (r record) setRight(start, end int, value string) {
+	width := end - start + 1
+	if len(value) < width {
+		value = strings.Repeat(" ", width-len(value)) + value
+	}
+	r.set(start, end, value)
+}
+
+// WriteEntries writes a team's meet entries as an SDIF meet registration
+// file, which meet hosts load into Hy-Tek Meet Manager and similar software.
+func WriteEntries(w io.Writer, entries *models.MeetEntries) error {
+	var records []record
+
+	a0 := newRecord("A0")
+	a0.set(3, 3, orgUSS)
+	a0.set(4, 11, sdifVersion)
+	a0.set(12, 13, fileEntries)
+	a0.set(44, 63, softwareName)
+	a0.set(106, 113, now().Format(dateLayout))
+	records = append(records, a0)
+
+	b1 := newRecord("B1")
+	b1.set(3, 3, orgUSS)
+	b1.set(12, 41, entries.Meet.Name)
+	city, state := entries.Meet.Location, ""
+	if m := cityState.FindStringSubmatch(city); m != nil {
+		city, state = strings.TrimSpace(m[1]), strings.ToUpper(m[2])
+	}
+	b1.set(86, 105, city)
+	b1.set(106, 107, state)
+	b1.set(122, 129, entries.Meet.MeetDate.Format(dateLayout))
+	b1.set(130, 137, entries.Meet.MeetDate.Format(dateLayout))
+	b1.set(150, 150, courseCodes[entries.Course])
+	records = append(records, b1)
+
+	c1 := newRecord("C1")
+	c1.set(3, 3, orgUSS)
+	c1.set(12, 17, strings.ToUpper(entries.TeamCode))
+	c1.set(18, 47, entries.TeamName)
+	records = append(records, c1)
+
+	swimmers := make(map[int]bool)
+	for _, entry := range entries.Entries {
+		stroke, ok := strokeCodes[entry.Stroke]
+		if !ok {
+			return fmt.Errorf("%s is not an individual stroke", entry.Stroke)
+		}
+		if entry.SeedMs > maxSeedMs {
+			return fmt.Errorf("Seed time for %s in the %d %s is too long for SDIF", entry.Swimmer.Name, entry.Distance, entry.Stroke)
+		}
+		swimmers[entry.Swimmer.ID] = true
+
+		d0 := newRecord("D0")
+		d0.set(3, 3, orgUSS)
+		d0.set(12, 39, sdifName(entry.Swimmer.Name))
+		d0.set(40, 51, entry.Swimmer.USSID)
+		if entry.Swimmer.DateOfBirth != nil {
+			d0.set(56, 63, entry.Swimmer.DateOfBirth.Format(dateLayout))
+		}
+		if entry.Swimmer.Age != nil {
+			d0.setRight(64, 65, strconv.Itoa(*entry.Swimmer.Age))
+		}
+		d0.set(66, 66, entry.Swimmer.Gender)
+		d0.set(67, 67, entry.Swimmer.Gender)
+		d0.setRight(68, 71, strconv.Itoa(entry.Distance))
+		d0.set(72, 72, stroke)
+		d0.setRight(73, 76, strconv.Itoa(entry.EventNum))
+		d0.set(77, 80, eventAgeOpen)
+		d0.set(81, 88, entries.Meet.MeetDate.Format(dateLayout))
+		d0.setRight(89, 96, sdifTime(entry.SeedMs))
+		d0.set(97, 97, courseCodes[entry.SeedCourse])
+		records = append(records, d0)
+	}
+
+	z0 := newRecord("Z0")
+	z0.set(3, 3, orgUSS)
+	z0.set(12, 13, fileEntries)
+	z0.setRight(44, 46, "1") // B records
+	z0.setRight(47, 49, "1") // Meets
+	z0.setRight(50, 53, "1") // C records
+	z0.setRight(54, 57, "1") // Teams
+	z0.setRight(58, 63, strconv.Itoa(len(entries.Entries)))
+	z0.setRight(64, 69, strconv.Itoa(len(swimmers)))
+	records = append(records, z0)
+
+	bw := bufio.NewWriter(w)
+	for _, r := range records {
+		bw.Write(r)
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+// sdifTime writes a time as SDIF does, in minutes, seconds and hundredths
+// such as "1:01.23" or "27.90"
+func sdifTime(timeMs int) string {
+	hundredths := timeMs / 10
+	minutes := hundredths / 6000
+	seconds := hundredths / 100 % 60
+	if minutes > 0 {
+		return fmt.Sprintf("%d:%02d.%02d", minutes, seconds, hundredths%100)
+	}
+	return fmt.Sprintf("%d.%02d", seconds, hundredths%100)
+}
+
+// sdifName turns a "First Middle Last" name into the SDIF "Last, First
+// Middle" form
+func sdifName(name string) string {
+	fields := strings.Fields(name)
+	if len(fields) < 2 {
+		return strings.Join(fields, " ")
+	}
+	last := len(fields) - 1
+	return fields[last] + ", " + strings.Join(fields[:last], " ")
+}
@@ -0,0 +1,81 @@
+package sdif
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"laplogger/models"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestWriteEntriesGolden(t *testing.T) {
+	now = func() time.Time { return time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	dob := time.Date(2012, 4, 1, 0, 0, 0, 0, time.UTC)
+	age := 14
+	jane := models.Swimmer{ID: 1, Name: "Jane Ann Smith", DateOfBirth: &dob, Gender: "F", USSID: "040112JANASMIT", Age: &age}
+	entries := &models.MeetEntries{
+		Meet: models.Meet{
+			Name:     "Fall Classic",
+			Location: "Springfield, IL",
+			MeetDate: time.Date(2026, 11, 14, 0, 0, 0, 0, time.UTC),
+		},
+		Course:   models.CourseSCY,
+		TeamCode: "ilssc",
+		TeamName: "Springfield Sharks",
+		Entries: []models.MeetEntry{
+			{Swimmer: jane, EventNum: 3, Distance: 50, Stroke: "Freestyle", SeedMs: 27900, SeedCourse: models.CourseSCY},
+			{Swimmer: jane, EventNum: 12, Distance: 200, Stroke: "Individual Medley", SeedMs: 141230, SeedCourse: models.CourseLCM},
+		},
+	}
+
+	var got bytes.Buffer
+	if err := WriteEntries(&got, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "entries.sd3")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("WriteEntries output differs from %s:\n got:\n%s\nwant:\n%s", golden, got.String(), want)
+	}
+
+	// The header fields are where SDIF v3 puts them
+	records := strings.Split(strings.TrimSuffix(got.String(), "\r\n"), "\r\n")
+	a0 := records[0]
+	fields := []struct {
+		name       string
+		start, end int
+		want       string
+	}{
+		{"version", 4, 11, "V3      "},
+		{"file code", 12, 13, "01"},
+		{"software", 44, 63, "LapLogger           "},
+		{"creation date", 106, 113, "10012026"},
+	}
+	for _, f := range fields {
+		if value := a0[f.start-1 : f.end]; value != f.want {
+			t.Errorf("A0 %s (columns %d-%d) = %q, want %q", f.name, f.start, f.end, value, f.want)
+		}
+	}
+	for i, r := range records {
+		if len(r) != recordLength {
+			t.Errorf("record %d is %d characters, want %d", i+1, len(r), recordLength)
+		}
+	}
+}
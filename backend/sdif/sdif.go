@@ -0,0 +1,479 @@
+// Package sdif reads USA Swimming Standard Data Interchange Format (SDIF
+// version 3) results files, as exported by Hy-Tek Meet Manager and Team
+// Manager with the .sd3 and .cl2 extensions.
+//
+// An SDIF file is a sequence of 160 character fixed-width records, each
+// starting with a two character code. Parse reads the meet (B1), team (C1),
+// individual result (D0), splits (G0), relay result (E0) and relay swimmer
+// (F0) records and skips the others. WriteEntries writes a team's meet
+// entries as a registration file. Column positions in this package are
+// 1-based and inclusive, as in the specification.
+package sdif
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"laplogger/models"
+)
+
+// dateLayout is the MMDDCCYY layout of SDIF dates
+const dateLayout = "01022006"
+
+// Result codes written in place of a time
+const (
+	codeNoTime    = "NT"
+	codeNoShow    = "NS"
+	codeDidNotFin = "DNF"
+	codeDQ        = "DQ"
+	codeScratch   = "SCR"
+)
+
+// courseDQ is the course code marking a disqualified swim that kept its time
+const courseDQ = "X"
+
+// A G0 record holds up to ten 8 column split times starting at column 64
+const (
+	splitsPerG0   = 10
+	splitWidth    = 8
+	firstSplitCol = 64
+)
+
+// strokes maps SDIF stroke codes to stroke names, and whether the event is a relay
+var strokes = map[string]struct {
+	name  string
+	relay bool
+}{
+	"1": {"Freestyle", false},
+	"2": {"Backstroke", false},
+	"3": {"Breaststroke", false},
+	"4": {"Butterfly", false},
+	"5": {"Individual Medley", false},
+	"6": {"Freestyle", true},
+	"7": {models.RelayStrokeMedley, true},
+}
+
+// courses maps SDIF course codes to courses
+var courses = map[string]string{
+	"1": models.CourseSCM, "S": models.CourseSCM,
+	"2": models.CourseSCY, "Y": models.CourseSCY,
+	"3": models.CourseLCM, "L": models.CourseLCM,
+}
+
+// roundColumns locates the time and course of each round of a result
+type roundColumns struct {
+	round      string
+	start, end int // Time
+	course     int
+	order      int // Leg order column of F0 records for the round
+}
+
+var individualRounds = []roundColumns{
+	{models.RoundPrelims, 98, 105, 106, 0},
+	{models.RoundSwimOff, 107, 114, 115, 0},
+	{models.RoundFinals, 116, 123, 124, 0},
+}
+
+var relayRounds = []roundColumns{
+	{models.RoundPrelims, 55, 62, 63, 77},
+	{models.RoundSwimOff, 64, 71, 72, 78},
+	{models.RoundFinals, 73, 80, 81, 79},
+}
+
+// splitRounds maps the round code of G0 records to rounds
+var splitRounds = map[string]string{
+	"P": models.RoundPrelims,
+	"S": models.RoundSwimOff,
+	"F": models.RoundFinals,
+}
+
+// parser holds the state carried from one record to the next
+type parser struct {
+	file   models.ResultsFile
+	errors []models.ImportError
+
+	course string            // Meet course, for times without one
+	teams  map[string]string // Team names by team code
+	club   string            // Team of the results being read
+
+	// Swims of the last D0 record and relays of the last E0 record, by round
+	swims  map[string]int
+	relays map[string]int
+	legs   map[int]map[int]models.ImportedRelayLeg // Legs of each relay by leg number
+}
+
+// Parse reads an SDIF file. Records that cannot be read are returned as
+// import errors alongside the results that could be.
+func Parse(r io.Reader) (*models.ResultsFile, []models.ImportError, error) {
+	p := &parser{
+		teams: make(map[string]string),
+		legs:  make(map[int]map[int]models.ImportedRelayLeg),
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1024), 64*1024)
+	for line := 1; scanner.Scan(); line++ {
+		record := strings.TrimRight(scanner.Text(), "\r\n")
+		if len(record) < 2 {
+			continue
+		}
+
+		var err error
+		switch record[:2] {
+		case "B1":
+			err = p.meet(record)
+		case "C1":
+			p.team(record)
+		case "D0":
+			err = p.individual(record, line)
+		case "G0":
+			err = p.splits(record)
+		case "E0":
+			err = p.relay(record, line)
+		case "F0":
+			err = p.relaySwimmer(record)
+		}
+		if err != nil {
+			p.errors = append(p.errors, models.ImportError{Line: line, Message: err.Error()})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if p.file.Meet.Name == "" {
+		return nil, nil, errors.New("File has no B1 meet record")
+	}
+	p.finishRelays()
+
+	return &p.file, p.errors, nil
+}
+
+// field returns columns start to end of a record, trimmed. Short records
+// read as blank past their end.
+func field(record string, start, end int) string {
+	if start > len(record) {
+		return ""
+	}
+	end = min(end, len(record))
+	return strings.TrimSpace(record[start-1 : end])
+}
+
+// meet reads the B1 meet record
+func (p *parser) meet(record string) error {
+	date, err := time.Parse(dateLayout, field(record, 122, 129))
+	if err != nil {
+		return fmt.Errorf("Invalid meet start date %q", field(record, 122, 129))
+	}
+
+	location := field(record, 86, 105)
+	if state := field(record, 106, 107); state != "" {
+		if location != "" {
+			location += ", "
+		}
+		location += state
+	}
+
+	p.file.Meet = models.ImportedMeet{
+		Name:     field(record, 12, 41),
+		Location: location,
+		Date:     date,
+	}
+	p.course = courses[strings.ToUpper(field(record, 150, 150))]
+	p.file.Meet.Course = p.course
+	return nil
+}
+
+// team reads a C1 team record; the results that follow belong to the team
+func (p *parser) team(record string) {
+	name := field(record, 18, 47)
+	p.teams[field(record, 12, 17)] = name
+	p.club = name
+}
+
+// individual reads a D0 individual result record, adding a swim for every
+// round with a result
+func (p *parser) individual(record string, line int) error {
+	p.swims = nil
+
+	stroke, ok := strokes[field(record, 72, 72)]
+	if !ok || stroke.relay {
+		return fmt.Errorf("Unknown individual stroke code %q", field(record, 72, 72))
+	}
+	distance, err := strconv.Atoi(field(record, 68, 71))
+	if err != nil || distance <= 0 {
+		return fmt.Errorf("Invalid event distance %q", field(record, 68, 71))
+	}
+
+	swimmer, err := p.swimmer(record, 12, 39, 40, 51, 56, 63, 66)
+	if err != nil {
+		return err
+	}
+	date := p.swimDate(field(record, 81, 88))
+
+	p.swims = make(map[string]int)
+	for _, rc := range individualRounds {
+		timeMs, status, course, ok, err := p.result(record, rc)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		p.swims[rc.round] = len(p.file.Swims)
+		p.file.Swims = append(p.file.Swims, models.ImportedSwim{
+			Line:     line,
+			Swimmer:  swimmer,
+			Distance: distance,
+			Stroke:   stroke.name,
+			Course:   course,
+			Round:    rc.round,
+			Date:     date,
+			TimeMs:   timeMs,
+			Status:   status,
+		})
+	}
+
+	if len(p.swims) == 0 {
+		return fmt.Errorf("%s has no result in the %d %s", swimmer.Name, distance, stroke.name)
+	}
+	return nil
+}
+
+// splits reads a G0 splits record, adding its splits to the matching round
+// of the last individual result
+func (p *parser) splits(record string) error {
+	round, ok := splitRounds[strings.ToUpper(field(record, 144, 144))]
+	if !ok {
+		round = models.RoundFinals
+	}
+	index, ok := p.swims[round]
+	if !ok {
+		return fmt.Errorf("Splits do not follow a %s result", strings.ToLower(round))
+	}
+
+	swim := &p.file.Swims[index]
+	if name := swimmerName(field(record, 16, 43)); name != swim.Swimmer.Name {
+		return fmt.Errorf("Splits for %s follow a result for %s", name, swim.Swimmer.Name)
+	}
+
+	splitDistance, err := strconv.Atoi(field(record, 59, 62))
+	if err != nil || splitDistance <= 0 {
+		return fmt.Errorf("Invalid split distance %q", field(record, 59, 62))
+	}
+
+	swim.SplitType = models.SplitTypeCumulative
+	if strings.ToUpper(field(record, 63, 63)) == "I" {
+		swim.SplitType = models.SplitTypeLap
+	}
+
+	for i := 0; i < splitsPerG0; i++ {
+		start := firstSplitCol + i*splitWidth
+		value := field(record, start, start+splitWidth-1)
+		if value == "" {
+			break
+		}
+		timeMs, err := models.ParseTime(value)
+		if err != nil {
+			return err
+		}
+		swim.Splits = append(swim.Splits, models.SplitInput{
+			Distance: splitDistance * (len(swim.Splits) + 1),
+			TimeMs:   timeMs,
+		})
+	}
+	return nil
+}
+
+// relay reads an E0 relay result record, adding a relay for every round
+// with a result
+func (p *parser) relay(record string, line int) error {
+	p.relays = nil
+
+	stroke, ok := strokes[field(record, 26, 26)]
+	if !ok || !stroke.relay {
+		return fmt.Errorf("Unknown relay stroke code %q", field(record, 26, 26))
+	}
+	distance, err := strconv.Atoi(field(record, 22, 25))
+	if err != nil || distance <= 0 {
+		return fmt.Errorf("Invalid relay distance %q", field(record, 22, 25))
+	}
+
+	team := p.teams[field(record, 13, 18)]
+	if team == "" {
+		team = field(record, 13, 18)
+	}
+	teamName := strings.TrimSpace(team + " " + field(record, 12, 12))
+	date := p.swimDate(field(record, 38, 45))
+
+	p.relays = make(map[string]int)
+	for _, rc := range relayRounds {
+		timeMs, status, course, ok, err := p.result(record, rc)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		p.relays[rc.round] = len(p.file.Relays)
+		p.file.Relays = append(p.file.Relays, models.ImportedRelay{
+			Line:     line,
+			TeamName: teamName,
+			Distance: distance,
+			Stroke:   stroke.name,
+			Course:   course,
+			Round:    rc.round,
+			Date:     date,
+			TimeMs:   timeMs,
+			Status:   status,
+		})
+	}
+
+	if len(p.relays) == 0 {
+		return fmt.Errorf("%s has no result in the %d %s relay", teamName, distance, stroke.name)
+	}
+	return nil
+}
+
+// relaySwimmer reads an F0 relay swimmer record, placing the swimmer on each
+// round of the last relay they swam in
+func (p *parser) relaySwimmer(record string) error {
+	if p.relays == nil {
+		return errors.New("Relay swimmer does not follow a relay result")
+	}
+
+	swimmer, err := p.swimmer(record, 23, 50, 51, 62, 66, 73, 76)
+	if err != nil {
+		return err
+	}
+
+	// A leg time can only be placed when the relay swam a single round
+	var splitMs *int
+	if value := field(record, 80, 87); value != "" && len(p.relays) == 1 {
+		if ms, err := models.ParseTime(value); err == nil {
+			splitMs = &ms
+		}
+	}
+
+	for _, rc := range relayRounds {
+		index, ok := p.relays[rc.round]
+		if !ok {
+			continue
+		}
+		leg, err := strconv.Atoi(field(record, rc.order, rc.order))
+		if err != nil || leg <= 0 {
+			continue // Alternate, or did not swim this round
+		}
+		if p.legs[index] == nil {
+			p.legs[index] = make(map[int]models.ImportedRelayLeg)
+		}
+		p.legs[index][leg] = models.ImportedRelayLeg{Swimmer: swimmer, SplitMs: splitMs}
+	}
+	return nil
+}
+
+// finishRelays puts the legs of every relay in swimming order
+func (p *parser) finishRelays() {
+	for index, legs := range p.legs {
+		order := make([]int, 0, len(legs))
+		for leg := range legs {
+			order = append(order, leg)
+		}
+		sort.Ints(order)
+		for _, leg := range order {
+			p.file.Relays[index].Legs = append(p.file.Relays[index].Legs, legs[leg])
+		}
+	}
+}
+
+// swimmer reads the swimmer named in a D0 or F0 record from the given columns
+func (p *parser) swimmer(record string, nameStart, nameEnd, idStart, idEnd, dobStart, dobEnd, sexCol int) (models.ImportedSwimmer, error) {
+	swimmer := models.ImportedSwimmer{
+		Name:  swimmerName(field(record, nameStart, nameEnd)),
+		USSID: strings.ToUpper(field(record, idStart, idEnd)),
+		Club:  p.club,
+	}
+	if swimmer.Name == "" {
+		return swimmer, errors.New("Swimmer name is missing")
+	}
+
+	if value := field(record, dobStart, dobEnd); value != "" {
+		dob, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return swimmer, fmt.Errorf("Invalid birth date %q for %s", value, swimmer.Name)
+		}
+		swimmer.DateOfBirth = &dob
+	}
+
+	swimmer.Gender, _ = models.ParseGender(field(record, sexCol, sexCol))
+	return swimmer, nil
+}
+
+// result reads the time of one round of a result record. ok is false when
+// the round was not swum.
+func (p *parser) result(record string, rc roundColumns) (timeMs int, status, course string, ok bool, err error) {
+	value := strings.ToUpper(field(record, rc.start, rc.end))
+	courseCode := strings.ToUpper(field(record, rc.course, rc.course))
+
+	course, known := courses[courseCode]
+	if !known {
+		course = p.course
+	}
+	if course == "" {
+		return 0, "", "", false, errors.New("Result has no course and the meet has none")
+	}
+
+	switch value {
+	case "", codeNoTime:
+		return 0, "", "", false, nil
+	case codeNoShow:
+		return 0, models.ResultDNS, course, true, nil
+	case codeDidNotFin:
+		return 0, models.ResultDNF, course, true, nil
+	case codeDQ:
+		return 0, models.ResultDQ, course, true, nil
+	case codeScratch:
+		return 0, models.ResultScratch, course, true, nil
+	}
+
+	timeMs, err = models.ParseTime(value)
+	if err != nil {
+		return 0, "", "", false, err
+	}
+	status = models.ResultOK
+	if courseCode == courseDQ {
+		status = models.ResultDQ
+	}
+	return timeMs, status, course, true, nil
+}
+
+// swimDate reads the date of a swim, falling back to the meet's start date
+func (p *parser) swimDate(value string) time.Time {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return date
+	}
+	return p.file.Meet.Date
+}
+
+// swimmerName turns an SDIF "Last, First M" name into "First Last". Only a
+// trailing middle initial is dropped, so "Smith, Mary Ann" is "Mary Ann Smith".
+func swimmerName(value string) string {
+	last, rest, found := strings.Cut(value, ",")
+	if !found {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	first := strings.Fields(rest)
+	if n := len(first); n > 1 && len([]rune(strings.TrimSuffix(first[n-1], "."))) == 1 {
+		first = first[:n-1]
+	}
+	if len(first) == 0 {
+		return strings.TrimSpace(last)
+	}
+	return strings.Join(first, " ") + " " + strings.Join(strings.Fields(last), " ")
+}
@@ -0,0 +1,105 @@
+package sdif
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"laplogger/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "results.sd3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	file, importErrors, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(importErrors) > 0 {
+		t.Fatalf("import errors: %+v", importErrors)
+	}
+
+	meetDate := date(2026, 10, 4)
+	wantMeet := models.ImportedMeet{Name: "Fall Invitational", Location: "Springfield, IL", Date: meetDate, Course: models.CourseSCY}
+	if !reflect.DeepEqual(file.Meet, wantMeet) {
+		t.Errorf("meet = %+v, want %+v", file.Meet, wantMeet)
+	}
+
+	club := "Springfield Sharks"
+	maryDOB, johnDOB := date(2012, 5, 14), date(2011, 1, 2)
+	mary := models.ImportedSwimmer{Name: "Mary Ann Smith", USSID: "ABCDEF123456", DateOfBirth: &maryDOB, Gender: models.GenderFemale, Club: club}
+	john := models.ImportedSwimmer{Name: "John Doe", DateOfBirth: &johnDOB, Gender: models.GenderMale, Club: club}
+	rick := models.ImportedSwimmer{Name: "Rick Roe", Gender: models.GenderMale, Club: club}
+	ann := models.ImportedSwimmer{Name: "Ann Poe", Gender: models.GenderFemale, Club: club}
+
+	wantSwims := []models.ImportedSwim{
+		{Line: 4, Swimmer: mary, Distance: 50, Stroke: "Freestyle", Course: models.CourseSCY, Round: models.RoundPrelims,
+			Date: meetDate, TimeMs: 28450, Status: models.ResultOK},
+		{Line: 4, Swimmer: mary, Distance: 50, Stroke: "Freestyle", Course: models.CourseSCY, Round: models.RoundFinals,
+			Date: meetDate, TimeMs: 27900, Status: models.ResultOK, SplitType: models.SplitTypeCumulative,
+			Splits: []models.SplitInput{{Distance: 25, TimeMs: 13500}, {Distance: 50, TimeMs: 27900}}},
+		{Line: 6, Swimmer: john, Distance: 100, Stroke: "Freestyle", Course: models.CourseSCY, Round: models.RoundPrelims,
+			Date: meetDate, Status: models.ResultDNS},
+		// An X course is a disqualified swim that kept its time, in the meet's course
+		{Line: 7, Swimmer: rick, Distance: 50, Stroke: "Backstroke", Course: models.CourseSCY, Round: models.RoundPrelims,
+			Date: date(2026, 10, 5), TimeMs: 31020, Status: models.ResultDQ},
+		{Line: 7, Swimmer: rick, Distance: 50, Stroke: "Backstroke", Course: models.CourseSCY, Round: models.RoundFinals,
+			Date: date(2026, 10, 5), Status: models.ResultScratch},
+		{Line: 8, Swimmer: ann, Distance: 100, Stroke: "Breaststroke", Course: models.CourseLCM, Round: models.RoundSwimOff,
+			Date: meetDate, Status: models.ResultDQ},
+	}
+	if len(file.Swims) != len(wantSwims) {
+		t.Fatalf("got %d swims, want %d: %+v", len(file.Swims), len(wantSwims), file.Swims)
+	}
+	for i, want := range wantSwims {
+		if !reflect.DeepEqual(file.Swims[i], want) {
+			t.Errorf("swim %d = %+v, want %+v", i, file.Swims[i], want)
+		}
+	}
+
+	split := func(ms int) *int { return &ms }
+	wantRelays := []models.ImportedRelay{{
+		Line: 9, TeamName: "Springfield Sharks A", Distance: 200, Stroke: "Freestyle", Course: models.CourseSCY,
+		Round: models.RoundFinals, Date: meetDate, TimeMs: 110000, Status: models.ResultOK,
+		Legs: []models.ImportedRelayLeg{
+			{Swimmer: mary, SplitMs: split(27000)},
+			{Swimmer: john, SplitMs: split(28000)},
+			{Swimmer: rick, SplitMs: split(27500)},
+			{Swimmer: ann, SplitMs: split(27500)},
+		},
+	}}
+	if !reflect.DeepEqual(file.Relays, wantRelays) {
+		t.Errorf("relays = %+v, want %+v", file.Relays, wantRelays)
+	}
+}
+
+func TestSwimmerName(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Smith, Mary Ann", "Mary Ann Smith"},
+		{"Smith, Mary Ann B", "Mary Ann Smith"},
+		{"Smith, Jane A", "Jane Smith"},
+		{"Smith, Jane A.", "Jane Smith"},
+		{"Smith, Jane", "Jane Smith"},
+		{"Van  Dyke, Jo", "Jo Van Dyke"},
+		{"Smith,", "Smith"},
+		{"Jane  Smith", "Jane Smith"},
+	}
+
+	for _, tt := range tests {
+		if got := swimmerName(tt.value); got != tt.want {
+			t.Errorf("swimmerName(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
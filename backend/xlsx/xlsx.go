@@ -0,0 +1,153 @@
+// Package xlsx writes Office Open XML spreadsheets (.xlsx) with a single
+// sheet, streaming rows as they are written rather than holding the sheet
+// in memory.
+//
+// An xlsx file is a zip archive of XML parts. Writer writes the workbook's
+// fixed parts first and then the sheet, with text in inline strings so no
+// shared string table has to be built before the rows are known.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+
+	rootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	workbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+
+	sheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	sheetEnd = `</sheetData></worksheet>`
+)
+
+// maxSheetName is the longest sheet name spreadsheet applications accept
+const maxSheetName = 31
+
+// ContentType is the MIME type of xlsx files
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Writer writes the rows of a one-sheet workbook
+type Writer struct {
+	archive *zip.Writer
+	sheet   io.Writer
+	rows    int
+}
+
+// NewWriter starts a workbook whose only sheet has the given name
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, sheetName)
+	if runes := []rune(name); len(runes) > maxSheetName {
+		name = string(runes[:maxSheetName])
+	}
+	var escaped strings.Builder
+	if err := xml.EscapeText(&escaped, []byte(name)); err != nil {
+		return nil, err
+	}
+
+	archive := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, escaped.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, sheetStart); err != nil {
+		return nil, err
+	}
+	return &Writer{archive: archive, sheet: sheet}, nil
+}
+
+// Write adds a row to the sheet. Values may be strings, integers or floats;
+// nil leaves the cell empty and anything else is written as text.
+func (w *Writer) Write(values []interface{}) error {
+	w.rows++
+	var row strings.Builder
+	fmt.Fprintf(&row, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(&row, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&row, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&row, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			fmt.Fprintf(&row, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&row, []byte(fmt.Sprint(v))); err != nil {
+				return err
+			}
+			row.WriteString(`</t></is></c>`)
+		}
+	}
+	row.WriteString(`</row>`)
+
+	_, err := io.WriteString(w.sheet, row.String())
+	return err
+}
+
+// Close finishes the sheet and the archive. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if _, err := io.WriteString(w.sheet, sheetEnd); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// columnName returns the letters of the zero-based column i: A to Z, then
+// AA and so on
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,148 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+
+	for _, tt := range tests {
+		if got := columnName(tt.i); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+// sheetCell is a cell of sheet1.xml as written by Writer
+type sheetCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type sheetXML struct {
+	Rows []struct {
+		Ref   string      `xml:"r,attr"`
+		Cells []sheetCell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, "Times: 2026/27")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wide := make([]interface{}, 28)
+	for i := range wide {
+		wide[i] = i
+	}
+	rows := [][]interface{}{
+		{"Name", nil, "Time", "Score"},
+		{"Smith <& Sons>", nil, 62340, 1.5},
+		wide,
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string][]byte)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = data
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		data, ok := parts[name]
+		if !ok {
+			t.Errorf("workbook has no %s", name)
+			continue
+		}
+		if err := wellFormed(data); err != nil {
+			t.Errorf("%s is not well-formed: %v", name, err)
+		}
+	}
+	if !bytes.Contains(parts["xl/workbook.xml"], []byte(`name="Times_ 2026_27"`)) {
+		t.Errorf("sheet name not sanitized: %s", parts["xl/workbook.xml"])
+	}
+
+	var sheet sheetXML
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if len(sheet.Rows) != len(rows) {
+		t.Fatalf("sheet has %d rows, want %d", len(sheet.Rows), len(rows))
+	}
+
+	// Empty cells are left out
+	want := []sheetCell{
+		{Ref: "A2", Type: "inlineStr", Inline: "Smith <& Sons>"},
+		{Ref: "C2", Value: "62340"},
+		{Ref: "D2", Value: "1.5"},
+	}
+	if got := sheet.Rows[1].Cells; !reflect.DeepEqual(got, want) {
+		t.Errorf("row 2 = %+v, want %+v", got, want)
+	}
+
+	last := sheet.Rows[2].Cells
+	if len(last) != len(wide) {
+		t.Fatalf("row 3 has %d cells, want %d", len(last), len(wide))
+	}
+	for i, ref := range map[int]string{0: "A3", 25: "Z3", 26: "AA3", 27: "AB3"} {
+		if last[i].Ref != ref {
+			t.Errorf("cell %d of row 3 is %s, want %s", i, last[i].Ref, ref)
+		}
+	}
+}
+
+// wellFormed reads an XML document through to its end
+func wellFormed(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -34,16 +34,103 @@ api.interceptors.response.use(
 
 // Swimmers API
 export const swimmersAPI = {
-  getAll: () => api.get('/swimmers'),
+  getAll: (params) => api.get('/swimmers', { params }),
   getById: (id) => api.get(`/swimmers/${id}`),
   create: (swimmer) => api.post('/swimmers', swimmer),
+  update: (id, swimmer) => api.put(`/swimmers/${id}`, swimmer),
+  archive: (id) => api.post(`/swimmers/${id}/archive`),
+  unarchive: (id) => api.post(`/swimmers/${id}/unarchive`),
+  getPersonalBests: (id, source) => api.get(`/swimmers/${id}/personal-bests`, { params: { source } }),
+  getProgression: (id, eventId, window) => api.get(`/swimmers/${id}/progression`, { params: { event_id: eventId, window } }),
+  merge: (id, duplicateId) => api.post(`/swimmers/${id}/merge`, { duplicate_id: duplicateId }),
 };
 
 // Times API
 export const timesAPI = {
-  getAll: () => api.get('/times'),
+  getAll: (params) => api.get('/times', { params }),
   getBySwimmer: (swimmerId) => api.get(`/times/${swimmerId}`),
   create: (time) => api.post('/times', time),
+  update: (id, time) => api.put(`/times/${id}`, time),
+  delete: (id) => api.delete(`/times/${id}`),
+  getHistory: (id) => api.get(`/times/${id}/history`),
+  getConversions: (id) => api.get(`/times/${id}/conversions`),
+  getSplits: (id) => api.get(`/times/${id}/splits`),
+  setSplits: (id, splits, splitType = 'cumulative') => api.put(`/times/${id}/splits`, { split_type: splitType, splits }),
+  getSplitAnalysis: (id) => api.get(`/times/${id}/split-analysis`),
+};
+
+// Meets API
+export const meetsAPI = {
+  getAll: () => api.get('/meets'),
+  getById: (id) => api.get(`/meets/${id}`),
+  create: (meet) => api.post('/meets', meet),
+  update: (id, meet) => api.put(`/meets/${id}`, meet),
+  delete: (id) => api.delete(`/meets/${id}`),
+  exportEntries: (id, entries) => api.post(`/meets/${id}/entries/sdif`, entries, { responseType: 'blob' }),
+  exportLenex: (id, params) => api.get(`/meets/${id}/results/lenex`, { params, responseType: 'blob' }),
+};
+
+// Relays API
+export const relaysAPI = {
+  getAll: (params) => api.get('/relays', { params }),
+  getById: (id) => api.get(`/relays/${id}`),
+  create: (relay) => api.post('/relays', relay),
+  update: (id, relay) => api.put(`/relays/${id}`, relay),
+  delete: (id) => api.delete(`/relays/${id}`),
+};
+
+// Preferences API
+export const preferencesAPI = {
+  get: () => api.get('/preferences'),
+  update: (preferences) => api.put('/preferences', preferences),
+};
+
+// Time Standards API
+export const standardsAPI = {
+  getAll: (params) => api.get('/standards', { params }),
+  create: (standard) => api.post('/standards', standard),
+  import: (standardSet, csv, dryRun = false) =>
+    api.post('/standards/import', csv, {
+      params: { standard_set: standardSet, dry_run: dryRun },
+      headers: { 'Content-Type': 'text/csv' },
+    }),
+  update: (id, standard) => api.put(`/standards/${id}`, standard),
+  delete: (id) => api.delete(`/standards/${id}`),
+};
+
+// Import API
+export const importAPI = {
+  sdif: (file, params) => {
+    const form = new FormData();
+    form.append('file', file);
+    return api.post('/import/sdif', form, { params });
+  },
+  lenex: (file, params) => {
+    const form = new FormData();
+    form.append('file', file);
+    return api.post('/import/lenex', form, { params });
+  },
+  swimmers: (file, params) => {
+    const form = new FormData();
+    form.append('file', file);
+    return api.post('/import/swimmers', form, { params });
+  },
+  times: (file, params) => {
+    const form = new FormData();
+    form.append('file', file);
+    return api.post('/import/times', form, { params });
+  },
+};
+
+// Export API
+export const exportAPI = {
+  times: (params) => api.get('/export/times', { params, responseType: 'blob' }),
+  swimmers: (params) => api.get('/export/swimmers', { params, responseType: 'blob' }),
+};
+
+// Reports API
+export const reportsAPI = {
+  getDQReport: (swimmerId) => api.get('/reports/dq', { params: { swimmer_id: swimmerId } }),
 };
 
 // Events API
@@ -56,4 +143,9 @@ export const strokesAPI = {
   getAll: () => api.get('/strokes'),
 };
 
+// DQ codes API
+export const dqCodesAPI = {
+  getAll: () => api.get('/dq-codes'),
+};
+
 export default api;